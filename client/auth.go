@@ -0,0 +1,37 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// 在发送Option之后完成认证握手，认证失败时返回带错误码的错误。
+// 服务端的握手消息不带换行符，读完认证结果后conn上不会有残留的数据
+func handshake(conn io.ReadWriter, creds server.Credentials) error {
+	dec := json.NewDecoder(conn)
+	var challenge server.AuthChallenge
+	if err := dec.Decode(&challenge); err != nil {
+		return server.Errorf(server.CodeUnavailable, "rpc client: read auth challenge: %v", err)
+	}
+	//没有认证信息时发送空的认证请求，由服务端决定是否接受
+	req := &server.AuthRequest{}
+	if creds != nil {
+		var err error
+		if req, err = creds.Respond(challenge.Challenge); err != nil {
+			return fmt.Errorf("rpc client: credentials: %w", err)
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+	var result server.AuthResult
+	if err := dec.Decode(&result); err != nil {
+		return server.Errorf(server.CodeUnavailable, "rpc client: read auth result: %v", err)
+	}
+	if result.Error != "" {
+		return server.NewError(server.Code(result.Code), result.Error)
+	}
+	return nil
+}
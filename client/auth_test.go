@@ -0,0 +1,122 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func startAuthServer(t *testing.T, auth server.Authenticator) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	srv := server.NewServer()
+	srv.SetAuthenticator(auth)
+	_ = server.RegisterFunc(srv, "Auth.Principal", func(ctx context.Context, _ int) (string, error) {
+		p, _ := server.PrincipalFromContext(ctx)
+		return p, nil
+	})
+	go srv.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+func TestHandshake(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	tests := []struct {
+		name      string
+		auth      server.Authenticator
+		creds     server.Credentials
+		principal string
+		code      server.Code //NewClient返回的错误码
+	}{
+		{"bearer", server.TokenAuthenticator(map[string]string{"secret-token": "alice"}), server.BearerToken("secret-token"), "alice", server.CodeOK},
+		{"bad bearer", server.TokenAuthenticator(map[string]string{"secret-token": "alice"}), server.BearerToken("guess"), "", server.CodeUnauthenticated},
+		{"hmac", server.HMACAuthenticator(map[string][]byte{"key1": []byte("k")}), server.HMACCredentials("key1", []byte("k")), "key1", server.CodeOK},
+		{"bad hmac", server.HMACAuthenticator(map[string][]byte{"key1": []byte("k")}), server.HMACCredentials("key1", []byte("x")), "", server.CodeUnauthenticated},
+		{"custom code", server.AuthenticatorFunc(func(context.Context, []byte, *server.AuthRequest) (string, error) {
+			return "", server.NewError(server.CodePermissionDenied, "banned")
+		}), server.BearerToken("t"), "", server.CodePermissionDenied},
+		{"no authenticator", nil, server.BearerToken("t"), "", server.CodeOK},
+		{"credentials with wrong scheme", server.TokenAuthenticator(map[string]string{"k": "alice"}), server.HMACCredentials("k", []byte("k")), "", server.CodeUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startAuthServer(t, tt.auth)
+			clt, err := XDial(addr, &server.Option{Credentials: tt.creds})
+			if code := server.CodeOf(err); code != tt.code {
+				t.Fatalf("expect code %s, got %v", tt.code, err)
+			}
+			if err != nil {
+				return
+			}
+			defer clt.Close()
+			p, err := CallT[int, string](ctx, clt, "Auth.Principal", 0)
+			if err != nil || p != tt.principal {
+				t.Fatalf("expect principal %q, got %q, %v", tt.principal, p, err)
+			}
+		})
+	}
+}
+
+func TestHandshake_ClientWithoutCredentials(t *testing.T) {
+	addr := startAuthServer(t, server.TokenAuthenticator(map[string]string{"secret-token": "alice"}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	//不握手的客户端能建立连接，但每个请求都被拒绝
+	clt, err := XDial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clt.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := CallT[int, string](ctx, clt, "Auth.Principal", 0); server.CodeOf(err) != server.CodeUnauthenticated {
+			t.Fatalf("expect unauthenticated, got %v", err)
+		}
+	}
+
+	//显式握手但没有认证信息时在NewClient中被拒绝
+	if _, err := XDial(addr, &server.Option{Handshake: true}); server.CodeOf(err) != server.CodeUnauthenticated {
+		t.Fatalf("expect unauthenticated, got %v", err)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := server.NewServer()
+	srv.SetAuthenticator(server.TokenAuthenticator(map[string]string{"t1": "alice", "t2": "bob"}))
+	policy, err := server.ParsePolicy([]byte(`{"rules": [{"effect": "allow", "principals": ["alice"], "methods": ["Foo.*"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetAuthorizer(policy)
+	_ = srv.Register(new(Foo))
+	go srv.Accept(l)
+	addr := "tcp@" + l.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for token, allow := range map[string]bool{"t1": true, "t2": false} {
+		clt, err := XDial(addr, &server.Option{Credentials: server.BearerToken(token)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := CallT[Args, int](ctx, clt, "Foo.Sum", Args{Num1: 1, Num2: 2})
+		_ = clt.Close()
+		if allow && (err != nil || sum != 3) {
+			t.Fatalf("%s: expect 3, got %d, %v", token, sum, err)
+		}
+		if !allow && server.CodeOf(err) != server.CodePermissionDenied {
+			t.Fatalf("%s: expect permission denied, got %v", token, err)
+		}
+	}
+}
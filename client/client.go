@@ -22,6 +22,7 @@ type Call struct {
 	Reply interface{}
 	Error error
 	Done chan *Call
+	Metadata map[string]string //随请求发送的元数据
 }
 
 func (call *Call) done() {
@@ -38,11 +39,20 @@ type Client struct {
 	pending map[uint64]*Call //存储未处理完的请求，键是编号，值是 Call 实例
 	closing bool //closing 是用户主动关闭的
 	shutdown bool //shutdown 置为 true 一般是有错误发生
+	done chan struct{} //连接断开（receive退出）时关闭
 }
 
 var _ io.Closer = (*Client)(nil)
 
-var ErrShutdown = errors.New("connection is shut down")
+// Invoker 是可以发起调用的客户端，Client、Pool、ReconnectClient和xclient.XClient都实现了它，
+// geerpc-gen生成的客户端代码通过它发起调用
+type Invoker interface {
+	Call(ctx context.Context,serviceMethod string,args,reply interface{}) error
+}
+
+var _ Invoker = (*Client)(nil)
+
+var ErrShutdown error = server.NewError(server.CodeUnavailable,"connection is shut down")
 
 type clientResult struct {
 	client *Client
@@ -81,7 +91,7 @@ func dialTimeout(f newClientFunc,network,address string,opts ...*server.Option)(
 
 	select {
 	case <- time.After(opt.ConnectTimeout):
-		return nil,fmt.Errorf("rpc client: connect timeout: expect within %s",opt.ConnectTimeout)
+		return nil,server.Errorf(server.CodeUnavailable,"rpc client: connect timeout: expect within %s",opt.ConnectTimeout)
 	case result := <-ch:
 		return result.client,result.err
 	}
@@ -104,6 +114,13 @@ func (client *Client) Close() error {
 	return client.cc.Close()
 }
 
+// NumPending 返回已经发出但还没有收到响应的调用数
+func (client *Client) NumPending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pending)
+}
+
 func (client *Client) IsAvailable() bool {
 	client.mu.Lock()
 	defer client.mu.Unlock()
@@ -143,6 +160,7 @@ func (client *Client) terminateCalls(err error) {
 	defer client.mu.Unlock()
 
 	client.shutdown = true
+	close(client.done)
 
 	for _,call := range client.pending {
 		call.Error = err
@@ -171,7 +189,11 @@ func (client *Client) receive() {
 			err = client.cc.ReadBody(nil)
 		case h.Error != "":
 
-			call.Error = fmt.Errorf(h.Error)
+			code := server.Code(h.Code)
+			if code == server.CodeOK { //老版本的服务端不会返回错误码
+				code = server.CodeUnknown
+			}
+			call.Error = server.NewError(code,h.Error)
 			err = client.cc.ReadBody(nil)
 			call.done()
 		default:
@@ -196,11 +218,21 @@ func NewClient(conn net.Conn,opt *server.Option) (*Client,error) {
 		return nil,err
 	}
 
+	if opt.Credentials != nil {
+		opt.Handshake = true
+	}
 	if err := json.NewEncoder(conn).Encode(opt);err != nil {
 		log.Println("rpc client: options error: ",err)
 		_ = conn.Close()
 		return nil,err
 	}
+	if opt.Handshake {
+		if err := handshake(conn,opt.Credentials);err != nil {
+			log.Println("rpc client: handshake error: ",err)
+			_ = conn.Close()
+			return nil,err
+		}
+	}
 
 	return newClientCodec(f(conn),opt),nil
 }
@@ -211,6 +243,7 @@ func newClientCodec(cc codec.Codec,opt *server.Option) *Client {
 		cc: cc,
 		opt: opt,
 		pending: make(map[uint64]*Call),
+		done: make(chan struct{}),
 	}
 
 	go client.receive()
@@ -271,6 +304,7 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
 
 	if err := client.cc.Write(&client.header,call.Args);err != nil {
 		call := client.removeCall(seq)
@@ -300,13 +334,21 @@ func (client *Client) Go(serviceMethod string,args,reply interface{},done chan *
 }
 
 //调用client.Go产生的call，执行Done阻塞等待
+// Call 调用serviceMethod并等待结果，ctx中通过WithMetadata设置的元数据随请求发送
 func (client *Client) Call(ctx context.Context,serviceMethod string,args,reply interface{}) error {
-	call := client.Go(serviceMethod,args,reply,make(chan *Call,1))
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args: args,
+		Reply: reply,
+		Done: make(chan *Call,1),
+		Metadata: MetadataFromContext(ctx),
+	}
+	client.send(call)
 
 	select {
 	case <- ctx.Done():
 		client.removeCall(call.Seq)
-		return errors.New("rpc client: call failed: "+ctx.Err().Error())
+		return fmt.Errorf("rpc client: call failed: %w",ctx.Err())
 	case call := <- call.Done:
 		return call.Error
 	}
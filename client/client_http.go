@@ -39,6 +39,8 @@ func XDial(rpcAddr string, opts ...*server.Option) (*Client, error) {
 	switch protocol {
 	case "http":
 		return DialHTTP("tcp",addr,opts...)
+	case "tls":
+		return DialTLS("tcp",addr,opts...)
 	default:
 		return Dial(protocol,addr,opts...)
 	}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnState 是ReconnectClient的连接状态
+type ConnState int
+
+const (
+	StateConnecting ConnState = iota
+	StateReady
+	StateReconnecting
+	StateShutdown
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "CONNECTING"
+	case StateReady:
+		return "READY"
+	case StateReconnecting:
+		return "RECONNECTING"
+	case StateShutdown:
+		return "SHUTDOWN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ReconnectPolicy 决定重连期间新发起的调用如何处理
+type ReconnectPolicy int
+
+const (
+	QueueOnReconnect    ReconnectPolicy = iota // 排队等待重连成功（或ctx结束）
+	FailFastOnReconnect                        // 直接返回ErrReconnecting
+)
+
+type ReconnectOption struct {
+	InitialBackoff time.Duration //第一次重连前的等待时间，0表示使用DefaultReconnectOption的值
+	MaxBackoff     time.Duration //退避时间的上限，0表示不设上限
+	Multiplier     float64       //每次失败后退避时间的放大倍数，小于1时使用DefaultReconnectOption的值
+	Jitter         float64       //随机抖动比例，取值[0,1]
+	MaxRetries     int           //连续重连失败多少次后放弃，0表示一直重试
+	Policy         ReconnectPolicy
+}
+
+var DefaultReconnectOption = &ReconnectOption{
+	InitialBackoff: time.Millisecond * 100,
+	MaxBackoff:     time.Second * 10,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var ErrReconnecting error = server.NewError(server.CodeUnavailable, "rpc client: connection is reconnecting")
+
+// 没有设置MaxBackoff时退避时间也不能超过time.Duration的范围
+const maxUncappedBackoff = float64(math.MaxInt64 / 2)
+
+// 用DefaultReconnectOption补上没有设置的字段，否则退避时间为0，会不停地重连
+func (o *ReconnectOption) withDefaults() *ReconnectOption {
+	opt := *o
+	if opt.InitialBackoff <= 0 {
+		opt.InitialBackoff = DefaultReconnectOption.InitialBackoff
+	}
+	if opt.Multiplier < 1 {
+		opt.Multiplier = DefaultReconnectOption.Multiplier
+	}
+	return &opt
+}
+
+// 第retries次重连（从0开始）前需要等待的时间
+func (o *ReconnectOption) backoff(retries int, r *rand.Rand) time.Duration {
+	limit := maxUncappedBackoff
+	if o.MaxBackoff > 0 {
+		limit = float64(o.MaxBackoff)
+	}
+	d := float64(o.InitialBackoff)
+	for i := 0; i < retries && d < limit; i++ {
+		d *= o.Multiplier
+	}
+	if d > limit {
+		d = limit
+	}
+	//在[d*(1-jitter),d*(1+jitter)]之间随机，抖动之后仍然不能超过上限
+	d *= 1 + o.Jitter*(2*r.Float64()-1)
+	if d > limit {
+		d = limit
+	}
+	return time.Duration(d)
+}
+
+// ReconnectClient 在Client连接断开后按指数退避自动重新XDial，
+// 重连成功后会重新走一遍Option握手
+type ReconnectClient struct {
+	rpcAddr string
+	opt     *server.Option
+	ropt    *ReconnectOption
+	r       *rand.Rand
+
+	mu        sync.Mutex
+	client    *Client
+	state     ConnState
+	ready     chan struct{} //离开CONNECTING/RECONNECTING状态时关闭，排队的调用在此等待
+	listeners []func(from, to ConnState)
+	closed    chan struct{}
+}
+
+// DialReconnect 建立第一个连接，失败时直接返回错误；之后连接断开都会自动重连
+func DialReconnect(rpcAddr string, ropt *ReconnectOption, opts ...*server.Option) (*ReconnectClient, error) {
+	if ropt == nil {
+		ropt = DefaultReconnectOption
+	}
+	opt, err := parseOption(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &ReconnectClient{
+		rpcAddr: rpcAddr,
+		opt:     opt,
+		ropt:    ropt.withDefaults(),
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		state:   StateConnecting,
+		ready:   make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+
+	clt, err := XDial(rpcAddr, opt)
+	if err != nil {
+		return nil, err
+	}
+	rc.setClient(clt)
+	go rc.watch(clt)
+	return rc, nil
+}
+
+// OnStateChange 注册连接状态变化的回调，回调在重连协程中同步执行
+func (rc *ReconnectClient) OnStateChange(f func(from, to ConnState)) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.listeners = append(rc.listeners, f)
+}
+
+func (rc *ReconnectClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// 切换状态并通知回调，必须在不持有rc.mu时调用；
+// expect不为nil时，只有当前的client仍是expect才切换，避免把已经重连好的连接又标记为断开
+func (rc *ReconnectClient) setState(state ConnState, expect *Client) {
+	rc.mu.Lock()
+	from := rc.state
+	if from == state || from == StateShutdown || (expect != nil && rc.client != expect) {
+		rc.mu.Unlock()
+		return
+	}
+	rc.state = state
+	switch state {
+	case StateConnecting, StateReconnecting:
+		rc.client = nil
+		rc.ready = make(chan struct{})
+	case StateShutdown:
+		if from != StateReady {
+			close(rc.ready)
+		}
+	}
+	listeners := rc.listeners
+	rc.mu.Unlock()
+
+	for _, f := range listeners {
+		f(from, state)
+	}
+}
+
+func (rc *ReconnectClient) setClient(clt *Client) {
+	rc.mu.Lock()
+	from := rc.state
+	if from == StateShutdown {
+		rc.mu.Unlock()
+		_ = clt.Close()
+		return
+	}
+	rc.client = clt
+	rc.state = StateReady
+	close(rc.ready)
+	listeners := rc.listeners
+	rc.mu.Unlock()
+
+	for _, f := range listeners {
+		f(from, StateReady)
+	}
+}
+
+// 等待clt断开后不断重连，直到成功、超过MaxRetries或者rc被关闭
+func (rc *ReconnectClient) watch(clt *Client) {
+	for {
+		select {
+		case <-clt.done:
+		case <-rc.closed:
+			return
+		}
+
+		rc.setState(StateReconnecting, clt)
+		clt = nil
+		for retries := 0; clt == nil; retries++ {
+			if rc.ropt.MaxRetries > 0 && retries >= rc.ropt.MaxRetries {
+				log.Printf("rpc client: give up reconnecting %s after %d retries", rc.rpcAddr, retries)
+				rc.setState(StateShutdown, nil)
+				return
+			}
+			select {
+			case <-time.After(rc.ropt.backoff(retries, rc.r)):
+			case <-rc.closed:
+				return
+			}
+
+			var err error
+			if clt, err = XDial(rc.rpcAddr, rc.opt); err != nil {
+				log.Printf("rpc client: reconnect %s err: %v", rc.rpcAddr, err)
+			}
+		}
+		rc.setClient(clt)
+	}
+}
+
+// 返回当前可用的Client，重连期间按照Policy排队或者直接失败
+func (rc *ReconnectClient) current(ctx context.Context) (*Client, error) {
+	for {
+		rc.mu.Lock()
+		state, clt, ready := rc.state, rc.client, rc.ready
+		rc.mu.Unlock()
+
+		switch state {
+		case StateReady:
+			return clt, nil
+		case StateShutdown:
+			return nil, ErrShutdown
+		}
+		if rc.ropt.Policy == FailFastOnReconnect {
+			return nil, ErrReconnecting
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("rpc client: call failed: %w", ctx.Err())
+		}
+	}
+}
+
+// Call 与Client.Call相同；如果请求还没发出去连接就断了（ErrShutdown），会等重连后再发送
+func (rc *ReconnectClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	for {
+		clt, err := rc.current(ctx)
+		if err != nil {
+			return err
+		}
+		err = clt.Call(ctx, serviceMethod, args, reply)
+		if err != ErrShutdown || rc.State() == StateShutdown {
+			return err
+		}
+		//请求还没发出去连接就已经断开，不必等watch发现，直接进入重连状态后重试
+		rc.setState(StateReconnecting, clt)
+	}
+}
+
+func (rc *ReconnectClient) IsAvailable() bool {
+	return rc.State() == StateReady
+}
+
+func (rc *ReconnectClient) Close() error {
+	//检查状态、关闭closed和切换到SHUTDOWN在同一次加锁中完成，并发的Close只有一个能通过
+	rc.mu.Lock()
+	from := rc.state
+	if from == StateShutdown {
+		rc.mu.Unlock()
+		return ErrShutdown
+	}
+	clt := rc.client
+	close(rc.closed)
+	rc.state = StateShutdown
+	if from != StateReady {
+		close(rc.ready)
+	}
+	listeners := rc.listeners
+	rc.mu.Unlock()
+
+	for _, f := range listeners {
+		f(from, StateShutdown)
+	}
+	if clt != nil {
+		return clt.Close()
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Foo int
+
+type Args struct {
+	Num1 int
+	Num2 int
+}
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func startServer(t *testing.T, addr string) net.Listener {
+	var foo Foo
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal("network error: ", err)
+	}
+	srv := server.NewServer()
+	_ = srv.Register(&foo)
+	go srv.Accept(l)
+	return l
+}
+
+// 模拟连接被断开，并等待rc发现
+func breakConn(t *testing.T, rc *ReconnectClient) {
+	rc.mu.Lock()
+	clt := rc.client
+	rc.mu.Unlock()
+	_ = clt.cc.Close()
+	select {
+	case <-clt.done:
+	case <-time.After(time.Second):
+		t.Fatal("connection is not closed")
+	}
+	for {
+		rc.mu.Lock()
+		cur := rc.client
+		rc.mu.Unlock()
+		if cur != clt {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReconnectClient_Reconnect(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	rc, err := DialReconnect("tcp@"+l.Addr().String(), &ReconnectOption{
+		InitialBackoff: time.Millisecond * 10,
+		MaxBackoff:     time.Millisecond * 100,
+		Multiplier:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var mu sync.Mutex
+	var states []ConnState
+	rc.OnStateChange(func(from, to ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, to)
+	})
+
+	var reply int
+	if err := rc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect 3, got %d, err %v", reply, err)
+	}
+
+	breakConn(t, rc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := rc.Call(ctx, "Foo.Sum", &Args{Num1: 2, Num2: 3}, &reply); err != nil || reply != 5 {
+		t.Fatalf("expect 5 after reconnect, got %d, err %v", reply, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(states) < 2 || states[0] != StateReconnecting || states[len(states)-1] != StateReady {
+		t.Fatalf("unexpected state changes %v", states)
+	}
+}
+
+func TestReconnectClient_FailFast(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	addr := l.Addr().String()
+
+	rc, err := DialReconnect("tcp@"+addr, &ReconnectOption{
+		InitialBackoff: time.Millisecond * 50,
+		MaxBackoff:     time.Millisecond * 50,
+		Multiplier:     1,
+		Policy:         FailFastOnReconnect,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	_ = l.Close()
+	breakConn(t, rc)
+
+	var reply int
+	if err := rc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != ErrReconnecting {
+		t.Fatalf("expect ErrReconnecting, got %v", err)
+	}
+
+	l = startServer(t, addr)
+	defer l.Close()
+	deadline := time.Now().Add(time.Second * 2)
+	for !rc.IsAvailable() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if err := rc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect 3 after server restart, got %d, err %v", reply, err)
+	}
+}
+
+func TestReconnectClient_GiveUp(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	rc, err := DialReconnect("tcp@"+l.Addr().String(), &ReconnectOption{
+		InitialBackoff: time.Millisecond,
+		Multiplier:     1,
+		MaxRetries:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	_ = l.Close()
+	breakConn(t, rc)
+
+	var reply int
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rc.Call(ctx, "Foo.Sum", &Args{}, &reply); err != ErrShutdown {
+		t.Fatalf("expect ErrShutdown, got %v", err)
+	}
+	if rc.State() != StateShutdown {
+		t.Fatalf("expect SHUTDOWN, got %s", rc.State())
+	}
+}
+
+func TestReconnectOption_Backoff(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	capped := &ReconnectOption{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond * 5, Multiplier: 2}
+	if d := capped.backoff(10, r); d != time.Millisecond*5 {
+		t.Fatalf("expect backoff capped at 5ms, got %s", d)
+	}
+	//MaxBackoff为0时不设上限
+	uncapped := &ReconnectOption{InitialBackoff: time.Millisecond, Multiplier: 2}
+	if d := uncapped.backoff(10, r); d != time.Millisecond*1024 {
+		t.Fatalf("expect uncapped backoff 1024ms, got %s", d)
+	}
+	if d := uncapped.backoff(1000, r); d <= 0 {
+		t.Fatalf("expect uncapped backoff not to overflow, got %s", d)
+	}
+	//抖动之后也不能溢出或者超过上限
+	jittered := &ReconnectOption{InitialBackoff: time.Millisecond, Multiplier: 2, Jitter: 1}
+	for i := 0; i < 100; i++ {
+		if d := jittered.backoff(1000, r); d < 0 {
+			t.Fatalf("expect jittered backoff not to overflow, got %s", d)
+		}
+	}
+	cappedJitter := &ReconnectOption{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond * 5, Multiplier: 2, Jitter: 1}
+	for i := 0; i < 100; i++ {
+		if d := cappedJitter.backoff(10, r); d > time.Millisecond*5 {
+			t.Fatalf("expect jittered backoff capped at 5ms, got %s", d)
+		}
+	}
+
+	//没有设置的字段使用默认值，避免不停地重连
+	o := (&ReconnectOption{MaxRetries: 5}).withDefaults()
+	if o.InitialBackoff != DefaultReconnectOption.InitialBackoff || o.Multiplier != DefaultReconnectOption.Multiplier || o.MaxRetries != 5 {
+		t.Fatalf("expect zero fields to be filled from DefaultReconnectOption, got %+v", o)
+	}
+	if d := o.backoff(0, r); d != DefaultReconnectOption.InitialBackoff {
+		t.Fatalf("expect first backoff %s, got %s", DefaultReconnectOption.InitialBackoff, d)
+	}
+}
+
+func TestReconnectClient_ConcurrentClose(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	rc, err := DialReconnect("tcp@"+l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	shutdowns := 0
+	rc.OnStateChange(func(from, to ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		if to == StateShutdown {
+			shutdowns++
+		}
+	})
+
+	//并发的Close只有一个成功，SHUTDOWN只通知一次
+	var wg sync.WaitGroup
+	var okMu sync.Mutex
+	ok := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rc.Close() == nil {
+				okMu.Lock()
+				ok++
+				okMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Fatalf("expect exactly one Close to succeed, got %d", ok)
+	}
+	if shutdowns != 1 || rc.State() != StateShutdown {
+		t.Fatalf("expect one SHUTDOWN notification, got %d, state %s", shutdowns, rc.State())
+	}
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// DialTLS 与Dial相同，但是连接使用TLS，配置取自Option.TLSConfig，为nil时使用系统的根证书校验服务端。
+// 配置中没有ServerName时使用address中的主机名；设置Certificates即可在mutual TLS中出示客户端证书
+func DialTLS(network, address string, opts ...*server.Option) (*Client, error) {
+	return dialTimeout(func(conn net.Conn, opt *server.Option) (*Client, error) {
+		tlsConn := tls.Client(conn, tlsConfig(opt.TLSConfig, address))
+		//握手超时时dialTimeout会关闭conn，握手随之失败
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, fmt.Errorf("rpc client: tls handshake: %w", err)
+		}
+		return NewClient(tlsConn, opt)
+	}, network, address, opts...)
+}
+
+func tlsConfig(config *tls.Config, address string) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		config.ServerName = host
+	}
+	return config
+}
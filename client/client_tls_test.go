@@ -0,0 +1,121 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// 生成由ca签发的证书，ca为nil时生成自签名的CA证书
+func newCert(t *testing.T, cn string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := tmpl, interface{}(key)
+	if ca == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+type Whoami int
+
+func (w Whoami) Name(ctx context.Context, _ int, reply *string) error {
+	if p, ok := server.PeerFromContext(ctx); ok {
+		*reply = p.Identity()
+	}
+	return nil
+}
+
+func TestDialTLS_MutualTLS(t *testing.T) {
+	ca := newCert(t, "test ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := server.NewServer()
+	_ = srv.Register(new(Whoami))
+	_ = server.RegisterFunc(srv, "Peer.Identity", func(ctx context.Context, _ int) (string, error) {
+		p, _ := server.PeerFromContext(ctx)
+		return p.Identity(), nil
+	})
+	go srv.AcceptTLS(l, &tls.Config{
+		Certificates: []tls.Certificate{newCert(t, "server", &ca)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	addr := "tls@" + l.Addr().String()
+
+	clt, err := XDial(addr, &server.Option{TLSConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{newCert(t, "alice", &ca)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clt.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var name string
+	if err := clt.Call(ctx, "Whoami.Name", 0, &name); err != nil || name != "alice" {
+		t.Fatalf("Whoami.Name: %q, %v", name, err)
+	}
+	if name, err := CallT[int, string](ctx, clt, "Peer.Identity", 0); err != nil || name != "alice" {
+		t.Fatalf("Peer.Identity: %q, %v", name, err)
+	}
+
+	//没有客户端证书、不信任服务端证书和不使用TLS的连接都不能调用
+	for _, opt := range []*server.Option{
+		{TLSConfig: &tls.Config{RootCAs: pool}},
+		{TLSConfig: &tls.Config{Certificates: []tls.Certificate{newCert(t, "bob", &ca)}}},
+	} {
+		if c, err := XDial(addr, opt); err == nil {
+			err = c.Call(ctx, "Whoami.Name", 0, &name)
+			_ = c.Close()
+			if err == nil {
+				t.Fatal("expect call without valid certificates to fail")
+			}
+		}
+	}
+	plainCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if c, err := XDial("tcp@" + l.Addr().String()); err == nil {
+		err = c.Call(plainCtx, "Whoami.Name", 0, &name)
+		_ = c.Close()
+		if err == nil {
+			t.Fatal("expect plaintext call to fail")
+		}
+	}
+}
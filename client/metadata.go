@@ -0,0 +1,24 @@
+package client
+
+import "context"
+
+type metadataKey struct{}
+
+// WithMetadata 返回带有元数据md的ctx，用这个ctx发起的调用会把md放在请求头中发送给服务端。
+// ctx中已经有元数据时合并，相同的key以md为准
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	merged := make(map[string]string, len(md))
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext 返回ctx中的元数据，没有时返回nil
+func MetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
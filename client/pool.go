@@ -0,0 +1,264 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type PoolOption struct {
+	MinSize int //至少保持的连接数，连接断开后会补足
+	MaxSize int //最多的连接数
+	// 所有连接上进行中的调用数都达到该值时才新建连接，0表示只要没有空闲连接就新建
+	MaxPendingPerConn int
+	// 建立单个连接的方法，为nil时使用XDial
+	Dialer func(rpcAddr string, opts ...*server.Option) (*Client, error)
+	// 拨号失败后多久内不再拨号，期间需要新连接的Get直接返回上次的错误，0表示1s
+	DialFailureTTL time.Duration
+}
+
+const defaultDialFailureTTL = time.Second
+
+var DefaultPoolOption = &PoolOption{
+	MinSize:           1,
+	MaxSize:           4,
+	MaxPendingPerConn: 16,
+}
+
+// Pool 是到同一个地址的一组连接，每次调用选择进行中调用最少的连接，
+// 避免所有调用都在一个连接的sending锁上排队
+type Pool struct {
+	rpcAddr string
+	opts    []*server.Option //原样传给Dialer
+	popt    PoolOption
+
+	mu       sync.Mutex
+	clients  []*Client
+	dialing  int //正在建立的连接数
+	closed   bool
+	syncDial chan struct{} //没有可用连接时正在进行的同步拨号，结束时关闭
+	dialErr  error         //最近一次拨号的错误，拨号成功后清空
+	failedAt time.Time
+}
+
+// NewPool 建立MinSize个到rpcAddr的连接，rpcAddr的格式与XDial相同
+func NewPool(rpcAddr string, popt *PoolOption, opts ...*server.Option) (*Pool, error) {
+	if popt == nil {
+		popt = DefaultPoolOption
+	}
+	if _, err := parseOption(opts...); err != nil {
+		return nil, err
+	}
+	p := &Pool{
+		rpcAddr: rpcAddr,
+		opts:    opts,
+		popt:    *popt,
+	}
+	if p.popt.MinSize < 1 {
+		p.popt.MinSize = 1
+	}
+	if p.popt.MaxSize < p.popt.MinSize {
+		p.popt.MaxSize = p.popt.MinSize
+	}
+	if p.popt.Dialer == nil {
+		p.popt.Dialer = XDial
+	}
+	if p.popt.DialFailureTTL <= 0 {
+		p.popt.DialFailureTTL = defaultDialFailureTTL
+	}
+
+	for i := 0; i < p.popt.MinSize; i++ {
+		clt, err := p.popt.Dialer(rpcAddr, opts...)
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.clients = append(p.clients, clt)
+	}
+	return p, nil
+}
+
+// 去掉已经断开的连接，调用方需要持有p.mu
+func (p *Pool) prune() {
+	alive := p.clients[:0]
+	for _, clt := range p.clients {
+		if clt.IsAvailable() {
+			alive = append(alive, clt)
+		} else {
+			_ = clt.Close()
+		}
+	}
+	for i := len(alive); i < len(p.clients); i++ {
+		p.clients[i] = nil
+	}
+	p.clients = alive
+}
+
+// 记录一次拨号的结果，调用方需要持有p.mu
+func (p *Pool) dialed(err error) {
+	p.dialErr = err
+	if err != nil {
+		p.failedAt = time.Now()
+	}
+}
+
+// 上次拨号失败后是否还在等待期内，调用方需要持有p.mu
+func (p *Pool) backingOff() bool {
+	return p.dialErr != nil && time.Since(p.failedAt) < p.popt.DialFailureTTL
+}
+
+// 在后台新建一个连接，调用方需要持有p.mu
+func (p *Pool) grow() {
+	p.dialing++
+	go func() {
+		clt, err := p.popt.Dialer(p.rpcAddr, p.opts...)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.dialing--
+		p.dialed(err)
+		if err != nil {
+			log.Printf("rpc pool: dial %s err: %v", p.rpcAddr, err)
+			return
+		}
+		if p.closed {
+			_ = clt.Close()
+			return
+		}
+		p.clients = append(p.clients, clt)
+	}()
+}
+
+// Get 返回进行中调用最少的连接。所有连接都忙时在后台扩容，连接数不足MinSize时补足；
+// 没有任何可用连接时同步拨号，并发的调用共享这次拨号。拨号失败后DialFailureTTL内不再扩容，
+// 没有可用连接时直接返回拨号的错误
+func (p *Pool) Get() (*Client, error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrShutdown
+		}
+		p.prune()
+
+		var best *Client
+		bestPending := 0
+		for _, clt := range p.clients {
+			if n := clt.NumPending(); best == nil || n < bestPending {
+				best, bestPending = clt, n
+			}
+		}
+
+		if best != nil {
+			if !p.backingOff() {
+				size := len(p.clients) + p.dialing
+				if bestPending > 0 && bestPending >= p.popt.MaxPendingPerConn && size < p.popt.MaxSize {
+					p.grow()
+					size++
+				}
+				for ; size < p.popt.MinSize; size++ {
+					p.grow()
+				}
+			}
+			p.mu.Unlock()
+			return best, nil
+		}
+		if p.backingOff() {
+			err := p.dialErr
+			p.mu.Unlock()
+			return nil, err
+		}
+		if p.syncDial == nil {
+			break
+		}
+		//其他调用正在同步拨号，等它结束后重新选择
+		wait := p.syncDial
+		p.mu.Unlock()
+		<-wait
+		p.mu.Lock()
+	}
+
+	done := make(chan struct{})
+	p.syncDial = done
+	p.dialing++
+	p.mu.Unlock()
+
+	clt, err := p.popt.Dialer(p.rpcAddr, p.opts...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing--
+	p.syncDial = nil
+	close(done)
+	p.dialed(err)
+	if err != nil {
+		return nil, err
+	}
+	if p.closed {
+		_ = clt.Close()
+		return nil, ErrShutdown
+	}
+	//拨号期间后台扩容的连接可能已经达到MaxSize
+	p.prune()
+	if len(p.clients) >= p.popt.MaxSize {
+		_ = clt.Close()
+		return p.clients[0], nil
+	}
+	p.clients = append(p.clients, clt)
+	return clt, nil
+}
+
+func (p *Pool) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	clt, err := p.Get()
+	if err != nil {
+		return err
+	}
+	return clt.Call(ctx, serviceMethod, args, reply)
+}
+
+// Len 返回当前的连接数
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
+
+// NumPending 返回所有连接上进行中的调用数
+func (p *Pool) NumPending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, clt := range p.clients {
+		n += clt.NumPending()
+	}
+	return n
+}
+
+// IsAvailable 返回是否有可用的连接
+func (p *Pool) IsAvailable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	for _, clt := range p.clients {
+		if clt.IsAvailable() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrShutdown
+	}
+	p.closed = true
+	for _, clt := range p.clients {
+		_ = clt.Close()
+	}
+	p.clients = nil
+	return nil
+}
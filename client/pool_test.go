@@ -0,0 +1,208 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func (f Foo) Sleep(args Args, reply *int) error {
+	time.Sleep(time.Millisecond * time.Duration(args.Num1))
+	*reply = args.Num1
+	return nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestPool_GrowAndPickLeastLoaded(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	p, err := NewPool("tcp@"+l.Addr().String(), &PoolOption{MinSize: 1, MaxSize: 2, MaxPendingPerConn: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	busy, _ := p.Get()
+	done := make(chan error, 1)
+	go func() {
+		var reply int
+		done <- busy.Call(context.Background(), "Foo.Sleep", Args{Num1: 300}, &reply)
+	}()
+	waitFor(t, func() bool { return p.NumPending() == 1 })
+
+	//唯一的连接忙时在后台扩容
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return p.Len() == 2 })
+
+	clt, _ := p.Get()
+	if clt == busy {
+		t.Fatal("expect the idle connection to be picked")
+	}
+	//达到MaxSize后不再扩容
+	go func() {
+		var reply int
+		_ = clt.Call(context.Background(), "Foo.Sleep", Args{Num1: 100}, &reply)
+	}()
+	waitFor(t, func() bool { return p.NumPending() == 2 })
+	_, _ = p.Get()
+	time.Sleep(time.Millisecond * 50)
+	if n := p.Len(); n != 2 {
+		t.Fatalf("expect pool size capped at 2, got %d", n)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPool_ReplaceBrokenConn(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	p, err := NewPool("tcp@"+l.Addr().String(), &PoolOption{MinSize: 2, MaxSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.mu.Lock()
+	broken := p.clients[0]
+	p.mu.Unlock()
+	_ = broken.cc.Close()
+	waitFor(t, func() bool { return !broken.IsAvailable() })
+
+	var reply int
+	if err := p.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect call on the remaining connection to succeed, got %d, %v", reply, err)
+	}
+	//断开的连接被去掉，并补足到MinSize
+	waitFor(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, clt := range p.clients {
+			if clt == broken {
+				return false
+			}
+		}
+		return len(p.clients) == 2
+	})
+}
+
+func TestPool_Close(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	p, err := NewPool("tcp@"+l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = p.Close()
+	if p.IsAvailable() {
+		t.Fatal("expect closed pool to be unavailable")
+	}
+	if _, err := p.Get(); err != ErrShutdown {
+		t.Fatalf("expect ErrShutdown, got %v", err)
+	}
+}
+
+func TestPool_DialFailureBackoff(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	var dials int32
+	p, err := NewPool("tcp@"+l.Addr().String(), &PoolOption{
+		MinSize:        1,
+		DialFailureTTL: time.Millisecond * 50,
+		Dialer: func(rpcAddr string, opts ...*server.Option) (*Client, error) {
+			if atomic.AddInt32(&dials, 1) > 1 {
+				return nil, errors.New("dial failed")
+			}
+			return XDial(rpcAddr, opts...)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.mu.Lock()
+	broken := p.clients[0]
+	p.mu.Unlock()
+	_ = broken.cc.Close()
+	waitFor(t, func() bool { return !broken.IsAvailable() })
+
+	//拨号失败后的等待期内直接返回上次的错误，不再拨号
+	for i := 0; i < 3; i++ {
+		if _, err := p.Get(); err == nil || err.Error() != "dial failed" {
+			t.Fatalf("expect dial error, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("expect 2 dials, got %d", n)
+	}
+	time.Sleep(time.Millisecond * 60)
+	_, _ = p.Get()
+	if n := atomic.LoadInt32(&dials); n != 3 {
+		t.Fatalf("expect redial after ttl, got %d dials", n)
+	}
+}
+
+func TestPool_ConcurrentRedialRespectsMaxSize(t *testing.T) {
+	l := startServer(t, "127.0.0.1:0")
+	defer l.Close()
+
+	var dials int32
+	p, err := NewPool("tcp@"+l.Addr().String(), &PoolOption{
+		MinSize: 1,
+		MaxSize: 2,
+		Dialer: func(rpcAddr string, opts ...*server.Option) (*Client, error) {
+			atomic.AddInt32(&dials, 1)
+			time.Sleep(time.Millisecond * 20)
+			return XDial(rpcAddr, opts...)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.mu.Lock()
+	broken := p.clients[0]
+	p.mu.Unlock()
+	_ = broken.cc.Close()
+	waitFor(t, func() bool { return !broken.IsAvailable() })
+
+	//唯一的连接断开后，并发的Get共享一次拨号
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Get(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := p.Len(); n > 2 {
+		t.Fatalf("expect pool size capped at 2, got %d", n)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("expect one redial, got %d dials", n-1)
+	}
+}
@@ -0,0 +1,11 @@
+package client
+
+import "context"
+
+// CallT 是类型安全的Call，reply由Resp决定，不需要调用方自己分配。
+// c可以是Client、Pool、ReconnectClient或xclient.XClient
+func CallT[Req, Resp any](ctx context.Context, c Invoker, serviceMethod string, req Req) (Resp, error) {
+	var resp Resp
+	err := c.Call(ctx, serviceMethod, req, &resp)
+	return resp, err
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"GeekRPC/server"
+	"context"
+	"net"
+	"testing"
+)
+
+type Product struct {
+	Value int
+}
+
+type Meta int
+
+// 第一个参数是context.Context的方法也可以注册
+func (m Meta) Lookup(ctx context.Context, key string, reply *string) error {
+	*reply = server.MetadataFromContext(ctx)[key]
+	return nil
+}
+
+func TestCallT(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := server.NewServer()
+	_ = srv.Register(new(Foo))
+	_ = srv.Register(new(Meta))
+	_ = server.RegisterFunc(srv, "Foo.Mul", func(ctx context.Context, args Args) (*Product, error) {
+		return &Product{Value: args.Num1 * args.Num2}, nil
+	})
+	_ = server.RegisterFunc(srv, "Meta.Get", func(ctx context.Context, key string) (string, error) {
+		v, ok := server.MetadataFromContext(ctx)[key]
+		if !ok {
+			return "", server.Errorf(server.CodeNotFound, "no metadata %s", key)
+		}
+		return v, nil
+	})
+	go srv.Accept(l)
+
+	clt, err := XDial("tcp@" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clt.Close()
+	ctx := context.Background()
+
+	if sum, err := CallT[Args, int](ctx, clt, "Foo.Sum", Args{Num1: 1, Num2: 2}); err != nil || sum != 3 {
+		t.Fatalf("Foo.Sum: %d, %v", sum, err)
+	}
+	if p, err := CallT[Args, *Product](ctx, clt, "Foo.Mul", Args{Num1: 3, Num2: 4}); err != nil || p.Value != 12 {
+		t.Fatalf("Foo.Mul: %v, %v", p, err)
+	}
+	v, err := CallT[string, string](WithMetadata(ctx, map[string]string{"user": "alice"}), clt, "Meta.Get", "user")
+	if err != nil || v != "alice" {
+		t.Fatalf("Meta.Get: %q, %v", v, err)
+	}
+	v, err = CallT[string, string](WithMetadata(ctx, map[string]string{"user": "bob"}), clt, "Meta.Lookup", "user")
+	if err != nil || v != "bob" {
+		t.Fatalf("Meta.Lookup: %q, %v", v, err)
+	}
+	if _, err := CallT[string, string](ctx, clt, "Meta.Get", "user"); server.CodeOf(err) != server.CodeNotFound {
+		t.Fatalf("expect not found, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+// geerpc-gen 为一个包中可以注册为服务的类型生成类型安全的客户端代码。
+//
+//	geerpc-gen -dir ./arith -type Arith
+//
+// 对每个类型T生成TClient，方法签名为Method(ctx, args) (*Reply, error)，
+// 通过client.Invoker发起调用，可以用在client.Client、client.Pool和xclient.XClient上。
+// 生成的文件与源码在同一个包中，默认为<包名>_geerpc.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package to scan")
+	types := flag.String("type", "", "comma-separated type names, default all types with RPC methods")
+	output := flag.String("output", "", "output file, default <package>_geerpc.go in -dir")
+	flag.Parse()
+
+	var only []string
+	if *types != "" {
+		only = strings.Split(*types, ",")
+	}
+	pkg, src, err := generate(*dir, only)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "geerpc-gen:", err)
+		os.Exit(1)
+	}
+	out := *output
+	if out == "" {
+		out = filepath.Join(*dir, pkg+"_geerpc.go")
+	}
+	if err := os.WriteFile(out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "geerpc-gen:", err)
+		os.Exit(1)
+	}
+}
+
+type method struct {
+	Name  string
+	Arg   string //参数类型的源码
+	Reply string //返回值指针指向的类型的源码
+
+	imports map[string]string //参数类型用到的包名到import路径
+	err     error             //参数类型用到的包无法解析，只在该类型被选中时报错
+}
+
+type service struct {
+	Name    string
+	Methods []method
+}
+
+const generatedSuffix = "_geerpc.go"
+
+// generate 解析dir中的包，返回包名和生成的代码
+func generate(dir string, only []string) (string, []byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && !strings.HasSuffix(fi.Name(), generatedSuffix)
+	}, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pkgs) != 1 {
+		return "", nil, fmt.Errorf("expect one package in %s, got %d", dir, len(pkgs))
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	services := make(map[string]*service)
+	for _, file := range pkg.Files {
+		fileImports := importsOf(file)
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+				continue
+			}
+			typeName := receiverName(fn.Recv.List[0].Type)
+			if !ast.IsExported(typeName) {
+				continue
+			}
+			m, ok := rpcMethod(fset, fn)
+			if !ok {
+				continue
+			}
+			params := flatten(fn.Type.Params)
+			m.imports = make(map[string]string)
+			for _, name := range selectorPackages(params[len(params)-2:]) {
+				path, ok := fileImports[name]
+				if !ok {
+					m.err = fmt.Errorf("%s.%s: can't resolve package %s", typeName, m.Name, name)
+					break
+				}
+				m.imports[name] = path
+			}
+			s := services[typeName]
+			if s == nil {
+				s = &service{Name: typeName}
+				services[typeName] = s
+			}
+			s.Methods = append(s.Methods, m)
+		}
+	}
+
+	var selected []*service
+	if len(only) == 0 {
+		for _, s := range services {
+			selected = append(selected, s)
+		}
+	} else {
+		for _, name := range only {
+			s := services[strings.TrimSpace(name)]
+			if s == nil {
+				return "", nil, fmt.Errorf("type %s has no RPC methods", name)
+			}
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		return "", nil, errors.New("no types with RPC methods found")
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+	//只导入选中的类型用到的包，没有选中的类型用到的包可能无法解析，或者在生成的代码中没有用到
+	imports := make(map[string]string)
+	for _, s := range selected {
+		sort.Slice(s.Methods, func(i, j int) bool { return s.Methods[i].Name < s.Methods[j].Name })
+		for _, m := range s.Methods {
+			if m.err != nil {
+				return "", nil, m.err
+			}
+			for name, path := range m.imports {
+				imports[name] = path
+			}
+		}
+	}
+
+	src, err := render(pkg.Name, imports, selected)
+	return pkg.Name, src, err
+}
+
+func importsOf(file *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// rpcMethod 按照server.registerMethods的规则判断fn能否作为RPC方法：
+// 导出的方法，两个参数，前面可以多一个context.Context，参数类型导出或者是内置类型，第二个参数是指针，只返回error
+func rpcMethod(fset *token.FileSet, fn *ast.FuncDecl) (method, bool) {
+	if !fn.Name.IsExported() {
+		return method{}, false
+	}
+	params := flatten(fn.Type.Params)
+	if len(params) == 3 && isContext(params[0]) {
+		params = params[1:]
+	}
+	if len(params) != 2 {
+		return method{}, false
+	}
+	results := flatten(fn.Type.Results)
+	if len(results) != 1 {
+		return method{}, false
+	}
+	if ident, ok := results[0].(*ast.Ident); !ok || ident.Name != "error" {
+		return method{}, false
+	}
+	reply, ok := params[1].(*ast.StarExpr)
+	if !ok || !exportedOrBuiltin(params[0]) || !exportedOrBuiltin(reply.X) {
+		return method{}, false
+	}
+	return method{Name: fn.Name.Name, Arg: exprString(fset, params[0]), Reply: exprString(fset, reply.X)}, true
+}
+
+// 是否是context.Context，不处理以其他名字导入context的情况
+func isContext(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == "context"
+}
+
+// 把a, b int这样的参数列表展开成每个参数一个类型
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var types []ast.Expr
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			types = append(types, f.Type)
+		}
+	}
+	return types
+}
+
+var builtinTypes = map[string]bool{
+	"bool": true, "string": true, "error": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+}
+
+// 与server中isExportedOrBuiltinType相同：有名字的类型要导出，没有名字的类型（指针、切片等）都可以
+func exportedOrBuiltin(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.IsExported() || builtinTypes[t.Name]
+	case *ast.SelectorExpr:
+		return t.Sel.IsExported()
+	}
+	return true
+}
+
+// 参数类型中用到的其他包
+func selectorPackages(types []ast.Expr) []string {
+	var names []string
+	for _, t := range types {
+		ast.Inspect(t, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					names = append(names, ident.Name)
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = format.Node(&buf, fset, expr)
+	return buf.String()
+}
+
+func render(pkg string, imports map[string]string, services []*service) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by geerpc-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	buf.WriteString("import (\n\t\"GeekRPC/client\"\n\t\"context\"\n")
+	names := make([]string, 0, len(imports))
+	for name := range imports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == filepath.Base(imports[name]) {
+			fmt.Fprintf(&buf, "\t%q\n", imports[name])
+		} else {
+			fmt.Fprintf(&buf, "\t%s %q\n", name, imports[name])
+		}
+	}
+	buf.WriteString(")\n")
+
+	for _, s := range services {
+		fmt.Fprintf(&buf, "\n// %sClient 是%s服务的客户端\n", s.Name, s.Name)
+		fmt.Fprintf(&buf, "type %sClient struct {\n\tinv client.Invoker\n}\n\n", s.Name)
+		fmt.Fprintf(&buf, "func New%sClient(inv client.Invoker) *%sClient {\n\treturn &%sClient{inv: inv}\n}\n", s.Name, s.Name, s.Name)
+		for _, m := range s.Methods {
+			fmt.Fprintf(&buf, "\n// %s 调用%s.%s\n", m.Name, s.Name, m.Name)
+			fmt.Fprintf(&buf, "func (c *%sClient) %s(ctx context.Context, args %s) (*%s, error) {\n", s.Name, m.Name, m.Arg, m.Reply)
+			fmt.Fprintf(&buf, "\treply := new(%s)\n", m.Reply)
+			fmt.Fprintf(&buf, "\tif err := c.inv.Call(ctx, %q, args, reply); err != nil {\n\t\treturn nil, err\n\t}\n", s.Name+"."+m.Name)
+			buf.WriteString("\treturn reply, nil\n}\n")
+		}
+	}
+	return format.Source(buf.Bytes())
+}
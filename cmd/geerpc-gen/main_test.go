@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	pkg, src, err := generate("testdata/arith", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg != "arith" {
+		t.Fatalf("expect package arith, got %s", pkg)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"func (c *ArithClient) Add(ctx context.Context, args Args) (*int, error)",
+		"func (c *ArithClient) Multiply(ctx context.Context, args Args) (*int, error)",
+		"func (c *ArithClient) Divide(ctx context.Context, args *Args) (*Quotient, error)",
+		"func (c *ArithClient) Double(ctx context.Context, args time.Duration) (*time.Duration, error)",
+		`c.inv.Call(ctx, "Arith.Divide", args, reply)`,
+		"func (c *EchoClient) Parse(ctx context.Context, args string) (*url.URL, error)",
+		`"time"`,
+		`"net/url"`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("generated code should contain %s:\n%s", want, code)
+		}
+	}
+	for _, unwanted := range []string{"NoReply", "ValueReply", "lower", "hidden", `"errors"`} {
+		if strings.Contains(code, unwanted) {
+			t.Fatalf("generated code should not contain %s:\n%s", unwanted, code)
+		}
+	}
+
+	//没有选中的类型用到的包不导入
+	_, src, err = generate("testdata/arith", []string{"Arith"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := string(src); strings.Contains(code, "Echo") || strings.Contains(code, `"net/url"`) {
+		t.Fatalf("generated code should only contain Arith:\n%s", code)
+	}
+	_, src, err = generate("testdata/arith", []string{"Echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := string(src); strings.Contains(code, `"time"`) || !strings.Contains(code, `"net/url"`) {
+		t.Fatalf("generated code should only import net/url:\n%s", code)
+	}
+
+	if _, _, err := generate("testdata/arith", []string{"Missing"}); err == nil {
+		t.Fatal("expect error for a type without RPC methods")
+	}
+}
+
+// 把生成的代码和源码放到模块中的临时包里，编译并运行调用真实服务的测试
+func TestGeneratedCodeCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test on the generated package")
+	}
+	_, src, err := generate("testdata/arith", []string{"Arith"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp(".", "gentest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyFile := func(from, to string) {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, to), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyFile("testdata/arith/arith.go", "arith.go")
+	copyFile("testdata/arith/client_test.go.txt", "client_test.go")
+	if err := os.WriteFile(filepath.Join(dir, "arith"+generatedSuffix), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("go", "test", "./"+dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated package failed: %v\n%s\n%s", err, out, src)
+	}
+}
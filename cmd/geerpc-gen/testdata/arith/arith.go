@@ -0,0 +1,51 @@
+package arith
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Quotient struct {
+	Quo, Rem int
+}
+
+type Arith int
+
+func (t *Arith) Multiply(args Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (t *Arith) Divide(args *Args, quo *Quotient) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	quo.Quo, quo.Rem = args.A/args.B, args.A%args.B
+	return nil
+}
+
+func (t *Arith) Double(d time.Duration, reply *time.Duration) error {
+	*reply = d * 2
+	return nil
+}
+
+func (t *Arith) Add(ctx context.Context, args Args, reply *int) error {
+	*reply = args.A + args.B
+	return ctx.Err()
+}
+
+// 以下方法不满足RPC方法的规则，不会生成
+func (t *Arith) NoReply(args Args) error { return nil }
+
+func (t *Arith) ValueReply(args Args, reply int) error { return nil }
+
+func (t *Arith) lower(args Args, reply *int) error { return nil }
+
+type hidden int
+
+func (hidden) Do(a int, reply *int) error { return nil }
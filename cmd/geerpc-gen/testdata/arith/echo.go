@@ -0,0 +1,15 @@
+package arith
+
+import "net/url"
+
+// Echo 用到了Arith没有用到的包，只生成Arith时不能导入它
+type Echo int
+
+func (Echo) Parse(raw string, reply *url.URL) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	*reply = *u
+	return nil
+}
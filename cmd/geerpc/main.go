@@ -0,0 +1,235 @@
+// geerpc 是调试用的命令行客户端，可以列出服务、查看方法签名，以及用JSON参数调用方法。
+//
+//	geerpc -addr tcp@127.0.0.1:9999 list
+//	geerpc -addr tcp@127.0.0.1:9999 describe Foo
+//	geerpc -addr tcp@127.0.0.1:9999 -H caller=ops call Foo.Sum '{"Num1":1,"Num2":2}'
+//	geerpc -registry http://127.0.0.1:9999/_geerpc_/registry -service Foo call Foo.Sum '{"Num1":1,"Num2":2}'
+//
+// 使用gob编码时需要服务端注册Reflection服务，用来根据方法签名构造参数类型；
+// 使用-codec json时直接发送JSON参数。
+package main
+
+import (
+	"GeekRPC/client"
+	"GeekRPC/codec"
+	"GeekRPC/server"
+	"GeekRPC/xclient"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// metadataFlag 收集多个-H key=value
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("expect key=value, got %q", s)
+	}
+	m[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "geerpc:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("geerpc", flag.ContinueOnError)
+	addr := fs.String("addr", "", "server address in protocol@addr form, e.g. tcp@127.0.0.1:9999")
+	registry := fs.String("registry", "", "registry URL used to resolve the server when -addr is empty")
+	service := fs.String("service", "", "service name to look up in the registry")
+	timeout := fs.Duration("timeout", time.Second*5, "timeout for connecting and for each call")
+	codecName := fs.String("codec", "gob", "codec to use: gob or json")
+	md := metadataFlag{}
+	fs.Var(md, "H", "metadata sent with the request as key=value, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: geerpc [flags] list | describe Service | call Service.Method [json args]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var codecType codec.Type
+	switch *codecName {
+	case "gob":
+		codecType = codec.GobType
+	case "json":
+		codecType = codec.JsonType
+	default:
+		return fmt.Errorf("unknown codec %q", *codecName)
+	}
+
+	rpcAddr, err := resolve(*addr, *registry, *service)
+	if err != nil {
+		return err
+	}
+	clt, err := client.XDial(rpcAddr, &server.Option{CodecType: codecType, ConnectTimeout: *timeout})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = clt.Close() }()
+	c := &cli{clt: clt, json: codecType == codec.JsonType, timeout: *timeout, md: md}
+
+	cmd := fs.Args()
+	if len(cmd) == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+	switch {
+	case cmd[0] == "list" && len(cmd) == 1:
+		return c.list(out)
+	case cmd[0] == "describe" && len(cmd) == 2:
+		return c.describe(out, cmd[1])
+	case cmd[0] == "call" && (len(cmd) == 2 || len(cmd) == 3):
+		body := "null"
+		if len(cmd) == 3 {
+			body = cmd[2]
+		}
+		return c.call(out, cmd[1], body)
+	}
+	fs.Usage()
+	return fmt.Errorf("bad command %q", strings.Join(cmd, " "))
+}
+
+// 没有指定地址时从注册中心选一个服务
+func resolve(addr, registry, service string) (string, error) {
+	if addr != "" {
+		return addr, nil
+	}
+	if registry == "" {
+		return "", errors.New("either -addr or -registry is required")
+	}
+	d := xclient.NewGeeRegistryDiscovery(registry, 0, &xclient.RegistryFilter{Service: service})
+	return d.Get(xclient.RandomSelect)
+}
+
+type cli struct {
+	clt     *client.Client
+	json    bool
+	timeout time.Duration
+	md      map[string]string
+}
+
+func (c *cli) invoke(serviceMethod string, args, reply interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if len(c.md) > 0 {
+		ctx = client.WithMetadata(ctx, c.md)
+	}
+	return c.clt.Call(ctx, serviceMethod, args, reply)
+}
+
+func (c *cli) list(out io.Writer) error {
+	var names []string
+	if err := c.invoke(server.ReflectionListMethod, 0, &names); err != nil {
+		return reflectionErr(err)
+	}
+	for _, name := range names {
+		fmt.Fprintln(out, name)
+	}
+	return nil
+}
+
+func (c *cli) describe(out io.Writer, service string) error {
+	schema, err := c.schema(service)
+	if err != nil {
+		return err
+	}
+	return printJSON(out, schema)
+}
+
+func (c *cli) schema(service string) (*server.ServiceSchema, error) {
+	var schema server.ServiceSchema
+	if err := c.invoke(server.ReflectionDescribeMethod, service, &schema); err != nil {
+		return nil, reflectionErr(err)
+	}
+	return &schema, nil
+}
+
+func (c *cli) call(out io.Writer, serviceMethod, body string) error {
+	if !json.Valid([]byte(body)) {
+		return fmt.Errorf("args are not valid JSON: %s", body)
+	}
+	//JSON编码时参数和返回值原样传递
+	if c.json {
+		var reply json.RawMessage
+		if err := c.invoke(serviceMethod, json.RawMessage(body), &reply); err != nil {
+			return err
+		}
+		return printJSON(out, reply)
+	}
+
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return fmt.Errorf("expect Service.Method, got %q", serviceMethod)
+	}
+	schema, err := c.schema(serviceMethod[:dot])
+	if err != nil {
+		return err
+	}
+	var method *server.MethodSchema
+	for i := range schema.Methods {
+		if schema.Methods[i].Name == serviceMethod[dot+1:] {
+			method = &schema.Methods[i]
+		}
+	}
+	if method == nil {
+		return fmt.Errorf("method %s not found", serviceMethod)
+	}
+
+	argType, err := buildType(method.ArgType)
+	if err != nil {
+		return fmt.Errorf("args: %w", err)
+	}
+	replyType, err := buildType(method.ReplyType)
+	if err != nil {
+		return fmt.Errorf("reply: %w", err)
+	}
+	argv := reflect.New(argType)
+	if err := json.Unmarshal([]byte(body), argv.Interface()); err != nil {
+		return fmt.Errorf("decode args: %w", err)
+	}
+	//reply一定是指针
+	replyv := reflect.New(replyType.Elem())
+	if err := c.invoke(serviceMethod, argv.Elem().Interface(), replyv.Interface()); err != nil {
+		return err
+	}
+	return printJSON(out, replyv.Interface())
+}
+
+func reflectionErr(err error) error {
+	if server.CodeOf(err) == server.CodeNotFound {
+		return fmt.Errorf("%w (is the Reflection service registered? try -codec json for calls)", err)
+	}
+	return err
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
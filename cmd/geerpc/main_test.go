@@ -0,0 +1,101 @@
+package main
+
+import (
+	"GeekRPC/server"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+type Point struct {
+	X, Y int
+}
+
+type Shape struct {
+	Name   string
+	Points []Point
+	Labels map[string]string
+}
+
+type Summary struct {
+	Name  string
+	Count int
+	Last  *Point
+}
+
+type Geo int
+
+func (g *Geo) Summarize(s Shape, reply *Summary) error {
+	reply.Name = s.Name + "/" + s.Labels["kind"]
+	reply.Count = len(s.Points)
+	if len(s.Points) > 0 {
+		reply.Last = &s.Points[len(s.Points)-1]
+	}
+	return nil
+}
+
+func (g *Geo) Add(p Point, reply *int) error {
+	*reply = p.X + p.Y
+	return nil
+}
+
+func startServer(t *testing.T, reflection bool) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	srv := server.NewServer()
+	_ = srv.Register(new(Geo))
+	if reflection {
+		srv.RegisterReflection()
+	}
+	go srv.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+func runCLI(t *testing.T, args ...string) string {
+	var out bytes.Buffer
+	if err := run(args, &out); err != nil {
+		t.Fatalf("geerpc %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String()
+}
+
+func TestCLI_ListAndDescribe(t *testing.T) {
+	addr := startServer(t, true)
+	if out := runCLI(t, "-addr", addr, "list"); out != "GeeRPC\nGeo\nReflection\n" {
+		t.Fatalf("unexpected list output %q", out)
+	}
+	out := runCLI(t, "-addr", addr, "describe", "Geo")
+	for _, want := range []string{`"Name": "Summarize"`, `"Name": "main.Shape"`, `"Name": "Points"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("describe output should contain %s, got %s", want, out)
+		}
+	}
+}
+
+func TestCLI_Call(t *testing.T) {
+	addr := startServer(t, true)
+	args := `{"Name":"tri","Points":[{"X":1,"Y":2},{"X":3,"Y":4}],"Labels":{"kind":"polygon"}}`
+	want := `{"Name":"tri/polygon","Count":2,"Last":{"X":3,"Y":4}}`
+	for _, codec := range []string{"gob", "json"} {
+		out := runCLI(t, "-addr", addr, "-codec", codec, "-H", "caller=test", "call", "Geo.Summarize", args)
+		if got := strings.Join(strings.Fields(out), ""); got != strings.ReplaceAll(want, " ", "") {
+			t.Fatalf("%s: expect %s, got %s", codec, want, out)
+		}
+	}
+}
+
+func TestCLI_WithoutReflection(t *testing.T) {
+	addr := startServer(t, false)
+	var out bytes.Buffer
+	err := run([]string{"-addr", addr, "call", "Geo.Add", `{"X":1,"Y":2}`}, &out)
+	if err == nil || !strings.Contains(err.Error(), "Reflection") {
+		t.Fatalf("expect a hint about the Reflection service, got %v", err)
+	}
+	if out := runCLI(t, "-addr", addr, "-codec", "json", "call", "Geo.Add", `{"X":1,"Y":2}`); strings.TrimSpace(out) != "3" {
+		t.Fatalf("expect 3, got %q", out)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"GeekRPC/server"
+	"fmt"
+	"reflect"
+)
+
+var basicTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"int":     reflect.TypeOf(int(0)),
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"uintptr": reflect.TypeOf(uintptr(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"string":  reflect.TypeOf(""),
+}
+
+// buildType 根据服务端描述的类型构造一个结构相同的类型。gob按字段名匹配，
+// 所以用reflect.StructOf构造的匿名struct可以与服务端的具名struct互相编解码。
+// 自引用的字段和无法构造的字段会被去掉，gob会忽略缺少的字段
+func buildType(s *server.TypeSchema) (reflect.Type, error) {
+	if t, ok := basicTypes[s.Kind]; ok {
+		return t, nil
+	}
+	switch s.Kind {
+	case "ptr":
+		elem, err := buildType(s.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PtrTo(elem), nil
+	case "slice":
+		elem, err := buildType(s.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	case "array":
+		elem, err := buildType(s.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ArrayOf(s.Len, elem), nil
+	case "map":
+		key, err := buildType(s.Key)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := buildType(s.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, elem), nil
+	case "struct":
+		if s.Recursive {
+			return nil, fmt.Errorf("recursive type %s is not supported", s.Name)
+		}
+		fields := make([]reflect.StructField, 0, len(s.Fields))
+		for _, f := range s.Fields {
+			t, err := buildType(f.Type)
+			if err != nil {
+				continue
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: t, Tag: reflect.StructTag(f.Tag)})
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, fmt.Errorf("type %s of kind %s is not supported", s.Name, s.Kind)
+}
@@ -6,6 +6,8 @@ type Header struct {
 	ServiceMethod string //服务名和方法名，通常与 Go 语言中的结构体和方法相映射
 	Seq uint64  //请求的序号，也可以认为是某个请求的 ID，用来区分不同的请求
 	Error string  //错误信息，客户端置为空，服务端如果如果发生错误，将错误信息置于 Error 中
+	Code int  //错误码，对应server.Code，Error为空时没有意义
+	Metadata map[string]string //请求附带的元数据，例如调用方标识、trace id，响应中为空
 }
 
 type Codec interface {
@@ -21,6 +23,7 @@ type Type string
 
 const (
 	GobType Type = "application/gob"
+	JsonType Type = "application/json"
 )
 
 var NewCodecFuncMap map[Type]NewCodecFunc
@@ -28,4 +31,5 @@ var NewCodecFuncMap map[Type]NewCodecFunc
 func init() {
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
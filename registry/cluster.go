@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultGossipInterval = time.Second * 5
+
+// tombstone 是一条注销记录
+type tombstone struct {
+	Service string    `json:"service,omitempty"`
+	Addr    string    `json:"addr"`
+	At      time.Time `json:"at"`
+}
+
+// syncState 是节点之间同步的完整状态
+type syncState struct {
+	Servers []persistedItem `json:"servers"`
+	Deleted []tombstone     `json:"deleted"`
+}
+
+type cluster struct {
+	peers    []string
+	interval time.Duration
+	client   *http.Client
+	done     chan struct{}
+}
+
+// JoinCluster 每隔interval与peers中的每个节点交换一次完整的注册信息（anti-entropy）。
+// 同一个实例以最后一次心跳的时间为准，注销记录比心跳新时删除实例。
+// 各节点的时钟需要大致同步。interval为0时使用5秒
+func (r *GeeRegistry) JoinCluster(peers []string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultGossipInterval
+	}
+	c := &cluster{
+		peers:    append([]string(nil), peers...),
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+		done:     make(chan struct{}),
+	}
+	r.leaveCluster()
+	r.mu.Lock()
+	r.cluster = c
+	r.mu.Unlock()
+	go r.gossipLoop(c)
+}
+
+// 停止集群同步
+func (r *GeeRegistry) leaveCluster() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cluster != nil {
+		close(r.cluster.done)
+		r.cluster = nil
+	}
+}
+
+func (r *GeeRegistry) tombstoneTTL() time.Duration {
+	if r.timeout == 0 {
+		return defaultTimeout
+	}
+	return r.timeout
+}
+
+func (r *GeeRegistry) gossipLoop(c *cluster) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			for _, peer := range c.peers {
+				if err := r.syncWith(c, peer); err != nil {
+					log.Println("rpc registry: sync with", peer, "err:", err)
+				}
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// 把自己的状态推给peer，并合并peer返回的状态
+func (r *GeeRegistry) syncWith(c *cluster, peer string) error {
+	body, err := json.Marshal(r.syncState())
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(peer)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("sync", "1")
+	u.RawQuery = q.Encode()
+
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var state syncState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return err
+	}
+	r.merge(&state)
+	return nil
+}
+
+func (r *GeeRegistry) handleSync(w http.ResponseWriter, req *http.Request) {
+	var state syncState
+	if err := json.NewDecoder(req.Body).Decode(&state); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.merge(&state)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(r.syncState())
+}
+
+func (r *GeeRegistry) syncState() *syncState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alive, _, _ := r.aliveLocked()
+	state := &syncState{
+		Servers: make([]persistedItem, 0, len(alive)),
+		Deleted: make([]tombstone, 0, len(r.deleted)),
+	}
+	for _, item := range alive {
+		state.Servers = append(state.Servers, persistedItem{ServerItem: item, Start: item.start})
+	}
+	for key, at := range r.deleted {
+		state.Deleted = append(state.Deleted, tombstone{Service: key.service, Addr: key.addr, At: at})
+	}
+	return state
+}
+
+// 合并另一个节点的状态，有变化时更新revision
+func (r *GeeRegistry) merge(state *syncState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, t := range state.Deleted {
+		key := serverKey{t.Service, t.Addr}
+		newer := false
+		if at, ok := r.deleted[key]; !ok || t.At.After(at) {
+			r.deleted[key] = t.At
+			newer = true
+		}
+		if s := r.servers[key]; s != nil && !s.start.After(t.At) {
+			delete(r.servers, key)
+			r.persist(opDelete, s)
+			changed = true
+		} else if newer {
+			//没有删除实例也要记录注销时间，重启后才能拒绝更旧的同步
+			r.persist(opDelete, &ServerItem{Service: t.Service, Addr: t.Addr})
+		}
+	}
+
+	now := time.Now()
+	for i := range state.Servers {
+		p := &state.Servers[i]
+		key := serverKey{p.Service, p.Addr}
+		if at, ok := r.deleted[key]; ok && !p.Start.After(at) {
+			continue
+		}
+		if r.timeout != 0 && !p.Start.Add(r.timeout).After(now) {
+			continue
+		}
+		s := r.servers[key]
+		if s != nil && !p.Start.After(s.start) {
+			continue
+		}
+		item := p.ServerItem
+		item.start = p.Start
+		if s == nil || !s.sameMeta(&item) {
+			changed = true
+		}
+		delete(r.deleted, key)
+		r.servers[key] = &item
+		r.persist(opPut, &item)
+	}
+	if changed {
+		r.bump()
+	}
+}
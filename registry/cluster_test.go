@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func startCluster(t *testing.T, n int, timeout time.Duration) []*GeeRegistry {
+	nodes := make([]*GeeRegistry, n)
+	urls := make([]string, n)
+	for i := range nodes {
+		nodes[i] = New(timeout)
+		ts := httptest.NewServer(nodes[i])
+		t.Cleanup(ts.Close)
+		urls[i] = ts.URL
+	}
+	for i, r := range nodes {
+		var peers []string
+		for j, u := range urls {
+			if j != i {
+				peers = append(peers, u)
+			}
+		}
+		r.JoinCluster(peers, time.Millisecond*20)
+		t.Cleanup(func() { _ = r.Close() })
+	}
+	return nodes
+}
+
+// 等待所有节点上都有n个存活的实例
+func waitCluster(t *testing.T, nodes []*GeeRegistry, n int) {
+	for _, r := range nodes {
+		waitAlive(t, r, n)
+	}
+}
+
+func TestCluster_Replicate(t *testing.T) {
+	nodes := startCluster(t, 3, 0)
+
+	nodes[0].putServer(ServerItem{Service: "Foo", Addr: "tcp@a", Zone: "z1"})
+	nodes[2].putServer(ServerItem{Addr: "tcp@b"})
+	waitCluster(t, nodes, 2)
+	alive, _ := nodes[1].aliveServers()
+	if alive[0].Service != "Foo" || alive[0].Zone != "z1" {
+		t.Fatalf("expect metadata replicated, got %+v", alive[0])
+	}
+
+	//在另一个节点上注销，同步后不会被其他节点同步回来
+	nodes[1].removeServer(ServerItem{Service: "Foo", Addr: "tcp@a"})
+	waitCluster(t, nodes, 1)
+	time.Sleep(time.Millisecond * 100)
+	for _, r := range nodes {
+		if n := numAlive(r); n != 1 {
+			t.Fatalf("expect deregistered server to stay removed, got %d", n)
+		}
+	}
+
+	//注销后重新注册
+	nodes[2].putServer(ServerItem{Service: "Foo", Addr: "tcp@a"})
+	waitCluster(t, nodes, 2)
+}
+
+func TestCluster_HeartbeatKeepsLeaseOnPeers(t *testing.T) {
+	nodes := startCluster(t, 2, time.Millisecond*200)
+
+	//心跳只发给第一个节点，第二个节点通过同步延长租约
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond * 50):
+				nodes[0].putServer(ServerItem{Addr: "tcp@a"})
+			}
+		}
+	}()
+	waitCluster(t, nodes, 1)
+	time.Sleep(time.Millisecond * 400)
+	if n := numAlive(nodes[1]); n != 1 {
+		t.Fatalf("expect lease to be extended by replication, got %d", n)
+	}
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	heartbeatInitialBackoff = time.Second
+	heartbeatRequestTimeout = time.Second * 10
+)
+
+// HeartbeatHandle 控制一个实例的心跳，Stop或者ctx结束时停止心跳并从注册中心注销
+type HeartbeatHandle struct {
+	registry string
+	item     ServerItem
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error //注销的结果
+}
+
+func Heartbeat(registry, addr string, duration time.Duration) *HeartbeatHandle {
+	return HeartbeatWithWeight(registry, addr, 0, duration)
+}
+
+// HeartbeatWithWeight 与Heartbeat相同，同时向注册中心上报负载均衡的权重
+func HeartbeatWithWeight(registry, addr string, weight int, duration time.Duration) *HeartbeatHandle {
+	return HeartbeatServer(registry, ServerItem{Addr: addr, Weight: weight}, duration)
+}
+
+// HeartbeatServer 以item中的服务名和元数据注册实例，并定时发送心跳
+func HeartbeatServer(registry string, item ServerItem, duration time.Duration) *HeartbeatHandle {
+	return HeartbeatContext(context.Background(), registry, item, duration)
+}
+
+// HeartbeatContext 与HeartbeatServer相同，ctx结束时停止心跳并注销实例。
+// 心跳失败时按指数退避重试，直到重新注册成功，不会因为注册中心短暂不可用而永久下线
+func HeartbeatContext(ctx context.Context, registry string, item ServerItem, duration time.Duration) *HeartbeatHandle {
+	if duration == 0 {
+		duration = defaultTimeout - time.Minute*1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	h := &HeartbeatHandle{
+		registry: registry,
+		item:     item,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	err := sendHeartbeat(ctx, registry, item)
+	go h.loop(ctx, duration, err)
+	return h
+}
+
+func (h *HeartbeatHandle) loop(ctx context.Context, duration time.Duration, err error) {
+	defer close(h.done)
+	backoff := heartbeatInitialBackoff
+	for {
+		wait := duration
+		if err != nil {
+			//退避时间不超过心跳间隔
+			wait = backoff
+			if backoff *= 2; backoff > duration {
+				backoff = duration
+			}
+		} else {
+			backoff = heartbeatInitialBackoff
+		}
+
+		select {
+		case <-time.After(wait):
+			err = sendHeartbeat(ctx, h.registry, h.item)
+		case <-ctx.Done():
+			//ctx已经结束，注销请求使用新的ctx
+			dctx, cancel := context.WithTimeout(context.Background(), heartbeatRequestTimeout)
+			h.err = deregister(dctx, h.registry, h.item)
+			cancel()
+			return
+		}
+	}
+}
+
+// Stop 停止心跳并从注册中心注销实例，返回注销的结果。可以重复调用
+func (h *HeartbeatHandle) Stop() error {
+	h.cancel()
+	<-h.done
+	return h.err
+}
+
+// Done 在心跳停止并注销后关闭
+func (h *HeartbeatHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+func sendHeartbeat(ctx context.Context, registry string, item ServerItem) error {
+	log.Println(item.Addr, "send heart beat to registry", registry)
+	if err := doRequest(ctx, "POST", registry, item); err != nil {
+		log.Println("rpc server: heart beat err:", err)
+		return err
+	}
+	return nil
+}
+
+func deregister(ctx context.Context, registry string, item ServerItem) error {
+	log.Println(item.Addr, "deregister from registry", registry)
+	err := doRequest(ctx, "DELETE", registry, item)
+	if err != nil {
+		log.Println("rpc server: deregister err:", err)
+	}
+	return err
+}
+
+func doRequest(ctx context.Context, method, registry string, item ServerItem) error {
+	body, err := json.Marshal(&item)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, heartbeatRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, registry, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	//注销时实例可能已经过期被删除
+	if resp.StatusCode != http.StatusOK && !(method == "DELETE" && resp.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func numAlive(r *GeeRegistry) int {
+	alive, _ := r.aliveServers()
+	return len(alive)
+}
+
+func waitAlive(t *testing.T, r *GeeRegistry, n int) {
+	deadline := time.Now().Add(time.Second * 3)
+	for numAlive(r) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d alive servers, got %d", n, numAlive(r))
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestHeartbeat_StopDeregisters(t *testing.T) {
+	r := New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	h := HeartbeatServer(ts.URL, ServerItem{Service: "Foo", Addr: "tcp@a"}, time.Millisecond*20)
+	h2 := Heartbeat(ts.URL, "tcp@b", time.Millisecond*20)
+	defer h2.Stop()
+	waitAlive(t, r, 2)
+
+	if err := h.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if n := numAlive(r); n != 1 {
+		t.Fatalf("expect stopped server to be deregistered, got %d alive", n)
+	}
+	if err := h.Stop(); err != nil {
+		t.Fatalf("second Stop should be a no-op, got %v", err)
+	}
+}
+
+func TestHeartbeat_ContextCancel(t *testing.T) {
+	r := New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := HeartbeatContext(ctx, ts.URL, ServerItem{Addr: "tcp@a"}, time.Millisecond*20)
+	waitAlive(t, r, 1)
+	cancel()
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat should stop after ctx is canceled")
+	}
+	if n := numAlive(r); n != 0 {
+		t.Fatalf("expect server to be deregistered, got %d alive", n)
+	}
+}
+
+func TestHeartbeat_RetryAfterOutage(t *testing.T) {
+	r := New(time.Millisecond * 500)
+	var down int32 = 1
+	//注册中心一开始不可用，之后恢复
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		r.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+
+	h := Heartbeat(ts.URL, "tcp@a", time.Millisecond*200)
+	defer h.Stop()
+	time.Sleep(time.Millisecond * 100)
+	if n := numAlive(r); n != 0 {
+		t.Fatalf("expect no server while registry is down, got %d", n)
+	}
+	atomic.StoreInt32(&down, 0)
+	waitAlive(t, r, 1)
+}
+
+func TestGeeRegistry_Delete(t *testing.T) {
+	r := New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	r.putServer(ServerItem{Service: "Foo", Addr: "tcp@a"})
+	r.putServer(ServerItem{Service: "Bar", Addr: "tcp@a"})
+	_, rev := r.aliveServers()
+
+	if err := deregister(context.Background(), ts.URL, ServerItem{Service: "Foo", Addr: "tcp@a"}); err != nil {
+		t.Fatal(err)
+	}
+	alive, newRev := r.aliveServers()
+	if len(alive) != 1 || alive[0].Service != "Bar" || newRev == rev {
+		t.Fatalf("expect only Bar left with a new revision, got %v rev %d", alive, newRev)
+	}
+
+	req, _ := http.NewRequest("DELETE", ts.URL, nil)
+	req.Header.Set("X-Geerpc-Server", "tcp@missing")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect 404 for unknown server, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,262 @@
+package registry
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotFile    = "snapshot.json"
+	logFile         = "registry.log"
+	compactInterval = time.Minute * 10
+	compactRecords  = 10000 //日志记录数超过该值时立即压缩
+)
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// persistedItem 是持久化的实例，带上最后一次心跳的时间，重启后按原来的租约过期
+type persistedItem struct {
+	ServerItem
+	Start time.Time `json:"start"`
+}
+
+type snapshot struct {
+	Revision uint64          `json:"revision"`
+	Servers  []persistedItem `json:"servers"`
+	Deleted  []tombstone     `json:"deleted,omitempty"` //注销记录，重启后仍然能拒绝其他节点同步回来的旧实例
+}
+
+type logRecord struct {
+	Op   string        `json:"op"`
+	Item persistedItem `json:"item"`
+	At   time.Time     `json:"at"` //opDelete的注销时间，老版本的日志中没有
+}
+
+// store 把注册信息保存为快照加追加日志，所有方法都需要持有GeeRegistry.mu
+type store struct {
+	dir     string
+	log     *os.File
+	w       *bufio.Writer
+	records int
+	done    chan struct{}
+}
+
+// NewPersistent 创建把注册信息保存在dir中的注册中心。启动时从快照和日志恢复未过期的实例，
+// 并定时把日志压缩成新的快照
+func NewPersistent(timeout time.Duration, dir string) (*GeeRegistry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	r := New(timeout)
+	if err := r.load(dir); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r.store = &store{dir: dir, log: f, w: bufio.NewWriter(f), done: make(chan struct{})}
+
+	//恢复后立即压缩，丢掉已经过期的实例和日志末尾可能不完整的记录
+	r.mu.Lock()
+	err = r.compactLocked()
+	r.mu.Unlock()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	go r.compactLoop(r.store)
+	return r, nil
+}
+
+// 从快照和日志恢复实例
+func (r *GeeRegistry) load(dir string) error {
+	var snap snapshot
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Servers {
+		r.apply(opPut, &snap.Servers[i], time.Time{})
+	}
+	for _, t := range snap.Deleted {
+		r.deleted[serverKey{t.Service, t.Addr}] = t.At
+	}
+	r.revision = snap.Revision
+
+	f, err := os.Open(filepath.Join(dir, logFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	dec := json.NewDecoder(f)
+	for {
+		var rec logRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err != io.EOF {
+				//崩溃时最后一条记录可能没有写完整
+				log.Println("rpc registry: stop replaying log:", err)
+			}
+			break
+		}
+		r.apply(rec.Op, &rec.Item, rec.At)
+		r.revision++
+	}
+
+	//过期的实例在这里丢掉，并且revision与重启前不同，watch的客户端会重新拉取
+	r.aliveLocked()
+	r.revision++
+	return nil
+}
+
+// 重放一条记录，at是opDelete的注销时间
+func (r *GeeRegistry) apply(op string, p *persistedItem, at time.Time) {
+	key := serverKey{p.Service, p.Addr}
+	switch op {
+	case opPut:
+		item := p.ServerItem
+		item.start = p.Start
+		r.servers[key] = &item
+		delete(r.deleted, key)
+	case opDelete:
+		if at.IsZero() {
+			delete(r.servers, key)
+			return
+		}
+		//集群同步来的注销记录可能比本地的心跳旧，这时只保留注销记录
+		if s := r.servers[key]; s != nil && !s.start.After(at) {
+			delete(r.servers, key)
+		}
+		if old, ok := r.deleted[key]; !ok || at.After(old) {
+			r.deleted[key] = at
+		}
+	}
+}
+
+// 追加一条日志，opDelete需要先写好r.deleted。调用方需要持有r.mu。写失败只打日志，内存中的注册信息仍然有效
+func (r *GeeRegistry) persist(op string, item *ServerItem) {
+	s := r.store
+	if s == nil {
+		return
+	}
+	rec := logRecord{Op: op, Item: persistedItem{ServerItem: *item, Start: item.start}}
+	if op == opDelete {
+		rec.At = r.deleted[serverKey{item.Service, item.Addr}]
+	}
+	data, err := json.Marshal(&rec)
+	if err == nil {
+		data = append(data, '\n')
+		if _, err = s.w.Write(data); err == nil {
+			err = s.w.Flush()
+		}
+	}
+	if err != nil {
+		log.Println("rpc registry: write log err:", err)
+		return
+	}
+	if s.records++; s.records >= compactRecords {
+		if err := r.compactLocked(); err != nil {
+			log.Println("rpc registry: compact err:", err)
+		}
+	}
+}
+
+// 把当前未过期的实例和注销记录写成新的快照并清空日志，调用方需要持有r.mu
+func (r *GeeRegistry) compactLocked() error {
+	s := r.store
+	alive, revision, _ := r.aliveLocked()
+	snap := snapshot{Revision: revision, Servers: make([]persistedItem, 0, len(alive))}
+	for _, item := range alive {
+		snap.Servers = append(snap.Servers, persistedItem{ServerItem: item, Start: item.start})
+	}
+	for key, at := range r.deleted {
+		snap.Deleted = append(snap.Deleted, tombstone{Service: key.service, Addr: key.addr, At: at})
+	}
+	data, err := json.Marshal(&snap)
+	if err != nil {
+		return err
+	}
+
+	//先写临时文件再rename，压缩中途崩溃时旧的快照和日志仍然完整
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	s.w.Reset(s.log)
+	s.records = 0
+	return nil
+}
+
+func (r *GeeRegistry) compactLoop(s *store) {
+	t := time.NewTicker(compactInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			var err error
+			r.mu.Lock()
+			if r.store == s {
+				err = r.compactLocked()
+			}
+			r.mu.Unlock()
+			if err != nil {
+				log.Println("rpc registry: compact err:", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// 压缩并关闭持久化文件，不是持久化的注册中心时什么也不做
+func (r *GeeRegistry) closeStore() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.store
+	if s == nil {
+		return nil
+	}
+	close(s.done)
+	err := r.compactLocked()
+	if cerr := s.log.Close(); err == nil {
+		err = cerr
+	}
+	r.store = nil
+	return err
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistent_RestoreAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewPersistent(time.Millisecond*300, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.putServer(ServerItem{Service: "Foo", Addr: "tcp@a", Weight: 3, Tags: map[string]string{"env": "prod"}})
+	r.putServer(ServerItem{Addr: "tcp@b"})
+	r.putServer(ServerItem{Addr: "tcp@c"})
+	r.removeServer(ServerItem{Addr: "tcp@c"})
+	_, rev := r.aliveServers()
+	start := r.servers[serverKey{"Foo", "tcp@a"}].start
+	//模拟崩溃：不压缩，直接关闭日志文件
+	_ = r.store.log.Close()
+
+	r2, err := NewPersistent(time.Millisecond*300, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r2.Close() }()
+	alive, rev2 := r2.aliveServers()
+	if len(alive) != 2 || alive[0].Addr != "tcp@a" || alive[1].Addr != "tcp@b" {
+		t.Fatalf("expect tcp@a and tcp@b restored, got %v", alive)
+	}
+	if alive[0].Weight != 3 || alive[0].Tags["env"] != "prod" {
+		t.Fatalf("expect metadata restored, got %+v", alive[0])
+	}
+	if rev2 == rev {
+		t.Fatal("expect a new revision after restart")
+	}
+	//租约从原来的心跳时间算起，而不是从重启时间
+	if got := r2.servers[serverKey{"Foo", "tcp@a"}].start; !got.Equal(start) {
+		t.Fatalf("expect original lease start %v, got %v", start, got)
+	}
+	time.Sleep(time.Millisecond * 350)
+	if n := numAlive(r2); n != 0 {
+		t.Fatalf("expect restored servers to expire on their original lease, got %d", n)
+	}
+}
+
+func TestPersistent_Compact(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewPersistent(0, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		r.putServer(ServerItem{Addr: "tcp@a"})
+	}
+	r.mu.Lock()
+	records := r.store.records
+	err = r.compactLocked()
+	r.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records != 10 {
+		t.Fatalf("expect 10 log records before compaction, got %d", records)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, logFile)); err != nil || fi.Size() != 0 {
+		t.Fatalf("expect empty log after compaction, got %v, %v", fi, err)
+	}
+
+	//压缩后继续追加，重启后快照和日志都要恢复
+	r.putServer(ServerItem{Addr: "tcp@b"})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := NewPersistent(0, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r2.Close() }()
+	if n := numAlive(r2); n != 2 {
+		t.Fatalf("expect 2 servers restored, got %d", n)
+	}
+}
+
+func TestPersistent_TruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewPersistent(0, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.putServer(ServerItem{Addr: "tcp@a"})
+	_, _ = r.store.log.WriteString(`{"op":"put","item":{"addr":"tcp@`)
+	_ = r.store.log.Close()
+
+	r2, err := NewPersistent(0, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r2.Close() }()
+	if n := numAlive(r2); n != 1 {
+		t.Fatalf("expect complete records to be restored, got %d", n)
+	}
+}
+
+func TestPersistent_Tombstones(t *testing.T) {
+	for _, crash := range []bool{true, false} {
+		dir := t.TempDir()
+		r, err := NewPersistent(time.Minute, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.putServer(ServerItem{Addr: "tcp@a"})
+		old := r.servers[serverKey{"", "tcp@a"}].start
+		r.removeServer(ServerItem{Addr: "tcp@a"})
+		//其他节点同步来的注销记录，本地没有对应的实例
+		r.merge(&syncState{Deleted: []tombstone{{Addr: "tcp@b", At: time.Now()}}})
+		if crash {
+			//模拟崩溃：注销记录只在日志中
+			_ = r.store.log.Close()
+		} else if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r2, err := NewPersistent(time.Minute, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//重启后仍然拒绝注销之前的心跳
+		r2.merge(&syncState{Servers: []persistedItem{
+			{ServerItem: ServerItem{Addr: "tcp@a"}, Start: old},
+			{ServerItem: ServerItem{Addr: "tcp@b"}, Start: old},
+		}})
+		if n := numAlive(r2); n != 0 {
+			t.Fatalf("crash=%v: expect deregistered servers to stay deleted, got %d", crash, n)
+		}
+		r2.mu.Lock()
+		n := len(r2.deleted)
+		r2.mu.Unlock()
+		if n != 2 {
+			t.Fatalf("crash=%v: expect 2 tombstones restored, got %d", crash, n)
+		}
+		_ = r2.Close()
+	}
+}
@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"GeekRPC/client"
+	"GeekRPC/server"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ProbePolicy 描述注册中心如何主动探测已注册的服务
+type ProbePolicy struct {
+	Interval         time.Duration //探测间隔
+	Timeout          time.Duration //单次探测（建立连接和调用）的超时时间
+	FailureThreshold int           //连续失败多少次后把实例标记为不健康，之后一次成功即恢复
+	//探测时建立连接使用的Option，服务端要求认证时需要带上Credentials，tls@地址需要带上TLSConfig。
+	//ConnectTimeout总是使用Timeout，为nil时使用默认的Option
+	Option *server.Option
+}
+
+var DefaultProbePolicy = &ProbePolicy{
+	Interval:         time.Second * 10,
+	Timeout:          time.Second * 3,
+	FailureThreshold: 3,
+}
+
+type probeState struct {
+	failures  int
+	unhealthy bool
+}
+
+// probe 探测一个地址，返回nil表示健康，测试时可以替换
+var probe = defaultProbe
+
+// 建立连接并调用Health.Check，服务没有注册Health服务时调用server.PingMethod
+func defaultProbe(ctx context.Context, rpcAddr string, p *ProbePolicy) error {
+	//每次探测复制一份Option，XDial会修改传入的Option
+	opt := &server.Option{}
+	if p.Option != nil {
+		*opt = *p.Option
+	}
+	opt.ConnectTimeout = p.Timeout
+	clt, err := client.XDial(rpcAddr, opt)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = clt.Close() }()
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	var resp server.HealthCheckResponse
+	err = clt.Call(ctx, server.HealthCheckMethod, server.HealthCheckRequest{}, &resp)
+	switch {
+	case err == nil && resp.Status != server.StatusServing:
+		return fmt.Errorf("rpc registry: server is %s", resp.Status)
+	case server.CodeOf(err) == server.CodeNotFound:
+		var ok bool
+		return clt.Call(ctx, server.PingMethod, 0, &ok)
+	}
+	return err
+}
+
+// SetProbePolicy 开启主动探测：注册中心定时连接每个已注册的地址并检查Health服务的状态，
+// 连续失败的实例不再出现在查询结果中，但仍然保留注册信息。nil表示关闭探测
+func (r *GeeRegistry) SetProbePolicy(p *ProbePolicy) {
+	r.mu.Lock()
+	old := r.prober
+	r.prober = nil
+	r.mu.Unlock()
+	//等待之前的探测协程退出，避免新旧两个协程同时探测
+	if old != nil {
+		old.cancel()
+		<-old.done
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p == nil {
+		//关闭探测后所有实例都视为健康
+		if len(r.probes) > 0 {
+			r.probes = make(map[string]*probeState)
+			r.bump()
+		}
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.prober = &prober{cancel: cancel, done: make(chan struct{})}
+	go r.probeLoop(ctx, *p, r.prober.done)
+}
+
+type prober struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *GeeRegistry) probeLoop(ctx context.Context, p ProbePolicy, done chan struct{}) {
+	defer close(done)
+	if p.Interval <= 0 {
+		p.Interval = DefaultProbePolicy.Interval
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultProbePolicy.Timeout
+	}
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = DefaultProbePolicy.FailureThreshold
+	}
+
+	t := time.NewTicker(p.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.probeAll(ctx, &p)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 并发探测所有已注册的地址，同一个地址以多个服务名注册时只探测一次
+func (r *GeeRegistry) probeAll(ctx context.Context, p *ProbePolicy) {
+	alive, _ := r.aliveServers()
+	addrs := make(map[string]bool, len(alive))
+	for _, s := range alive {
+		addrs[s.Addr] = true
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]error, len(addrs))
+	var wg sync.WaitGroup
+	for addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			err := probe(ctx, addr, p)
+			mu.Lock()
+			results[addr] = err
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for addr, err := range results {
+		st := r.probes[addr]
+		if st == nil {
+			st = &probeState{}
+			r.probes[addr] = st
+		}
+		if err == nil {
+			st.failures = 0
+			if st.unhealthy {
+				log.Println("rpc registry: server", addr, "is healthy again")
+				st.unhealthy = false
+				changed = true
+			}
+			continue
+		}
+		st.failures++
+		if !st.unhealthy && st.failures >= p.FailureThreshold {
+			log.Println("rpc registry: server", addr, "is unhealthy:", err)
+			st.unhealthy = true
+			changed = true
+		}
+	}
+	//已经注销或过期的地址不再记录
+	for addr := range r.probes {
+		if !addrs[addr] {
+			delete(r.probes, addr)
+		}
+	}
+	if changed {
+		r.bump()
+	}
+}
+
+// 去掉主动探测失败的实例
+func (r *GeeRegistry) filterHealthy(items []ServerItem) []ServerItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.probes) == 0 {
+		return items
+	}
+	healthy := items[:0]
+	for _, s := range items {
+		if st := r.probes[s.Addr]; st == nil || !st.unhealthy {
+			healthy = append(healthy, s)
+		}
+	}
+	return healthy
+}
@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"GeekRPC/server"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func healthyAddrs(r *GeeRegistry) map[string]bool {
+	alive, _ := r.aliveServers()
+	addrs := make(map[string]bool)
+	for _, s := range r.filterHealthy(alive) {
+		addrs[s.Addr] = true
+	}
+	return addrs
+}
+
+func TestProbe_WedgedServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go server.NewServer().Accept(l)
+
+	//只接受连接，从不处理请求
+	wedged, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wedged.Close()
+	var conns []net.Conn
+	var mu sync.Mutex
+	go func() {
+		for {
+			conn, err := wedged.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	good, bad := "tcp@"+l.Addr().String(), "tcp@"+wedged.Addr().String()
+	r := New(0)
+	defer func() { _ = r.Close() }()
+	r.putServer(ServerItem{Addr: good})
+	r.putServer(ServerItem{Addr: bad})
+	r.SetProbePolicy(&ProbePolicy{Interval: time.Millisecond * 20, Timeout: time.Millisecond * 50, FailureThreshold: 2})
+
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		addrs := healthyAddrs(r)
+		if len(addrs) == 1 && addrs[good] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect only %s to stay healthy, got %v", good, addrs)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	//实例仍然保留注册信息
+	if n := numAlive(r); n != 2 {
+		t.Fatalf("expect unhealthy server to stay registered, got %d", n)
+	}
+}
+
+func TestProbe_ThresholdAndRecovery(t *testing.T) {
+	var mu sync.Mutex
+	failing := true
+	probes := 0
+	probe = func(ctx context.Context, rpcAddr string, p *ProbePolicy) error {
+		mu.Lock()
+		defer mu.Unlock()
+		probes++
+		if failing {
+			return errors.New("probe failed")
+		}
+		return nil
+	}
+	defer func() { probe = defaultProbe }()
+
+	r := New(0)
+	r.putServer(ServerItem{Addr: "tcp@a"})
+	p := &ProbePolicy{Interval: time.Hour, Timeout: time.Second, FailureThreshold: 3}
+
+	_, rev := r.aliveServers()
+	for i := 0; i < 2; i++ {
+		r.probeAll(context.Background(), p)
+	}
+	if !healthyAddrs(r)["tcp@a"] {
+		t.Fatal("expect server to stay healthy before reaching the threshold")
+	}
+	r.probeAll(context.Background(), p)
+	if healthyAddrs(r)["tcp@a"] {
+		t.Fatal("expect server to be unhealthy after 3 failures")
+	}
+	_, rev2 := r.aliveServers()
+	if rev2 == rev {
+		t.Fatal("expect revision to change when health changes")
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	r.probeAll(context.Background(), p)
+	if !healthyAddrs(r)["tcp@a"] {
+		t.Fatal("expect server to recover after a successful probe")
+	}
+}
+
+func TestProbe_NotServing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := server.NewServer()
+	health, _ := srv.RegisterHealth()
+	go srv.Accept(l)
+	addr := "tcp@" + l.Addr().String()
+
+	if err := defaultProbe(context.Background(), addr, &ProbePolicy{Timeout: time.Second}); err != nil {
+		t.Fatalf("expect serving server to pass, got %v", err)
+	}
+	health.Shutdown()
+	if err := defaultProbe(context.Background(), addr, &ProbePolicy{Timeout: time.Second}); err == nil {
+		t.Fatal("expect server that is not serving to fail the probe")
+	}
+}
+
+func TestProbe_AuthenticatedServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := server.NewServer()
+	srv.SetAuthenticator(server.TokenAuthenticator(map[string]string{"probe-token": "registry"}))
+	go srv.Accept(l)
+	addr := "tcp@" + l.Addr().String()
+
+	//没有带认证信息的探测会被拒绝，带上token后可以通过
+	anonymous := &ProbePolicy{Timeout: time.Second, FailureThreshold: 1}
+	authed := &ProbePolicy{Timeout: time.Second, FailureThreshold: 1,
+		Option: &server.Option{Credentials: server.BearerToken("probe-token")}}
+	for _, c := range []struct {
+		p       *ProbePolicy
+		healthy bool
+	}{{anonymous, false}, {authed, true}} {
+		r := New(0)
+		r.putServer(ServerItem{Addr: addr})
+		r.probeAll(context.Background(), c.p)
+		r.probeAll(context.Background(), c.p)
+		if healthyAddrs(r)[addr] != c.healthy {
+			t.Fatalf("option %+v: expect healthy=%v", c.p.Option, c.healthy)
+		}
+		_ = r.Close()
+	}
+}
@@ -1,9 +1,12 @@
 package registry
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,73 +15,298 @@ import (
 type GeeRegistry struct {
 	timeout time.Duration
 	mu sync.Mutex
-	servers map[string]*ServerItem
+	servers map[serverKey]*ServerItem
+	revision uint64 //服务列表每次变化（加入、下线、权重改变）都加1
+	changed chan struct{} //服务列表变化时关闭并替换，用来唤醒watch请求
+	store *store //持久化注册信息，为nil时只保存在内存中
+	deleted map[serverKey]time.Time //注销记录，防止集群同步时把已经注销的实例同步回来
+	cluster *cluster //集群同步，为nil时是单节点
+	probes map[string]*probeState //按地址记录的主动探测结果
+	prober *prober //探测协程，没有开启探测时为nil
 }
 
+// ServerItem 是注册到注册中心的一个服务实例，同一个地址可以以不同的服务名注册多次
 type ServerItem struct {
-	Addr string
+	Service string `json:"service,omitempty"` //服务名，为空表示该地址提供所有服务
+	Addr string `json:"addr"`
+	Weight int `json:"weight,omitempty"` //负载均衡的权重，0表示未设置
+	Version string `json:"version,omitempty"`
+	Zone string `json:"zone,omitempty"`
+	Tags map[string]string `json:"tags,omitempty"`
 	start time.Time
 }
 
+type serverKey struct {
+	service string
+	addr string
+}
+
+// Serves 返回实例是否提供service，没有服务名的实例提供所有服务，service为空时匹配所有实例
+func (s *ServerItem) Serves(service string) bool {
+	return service == "" || s.Service == "" || s.Service == service
+}
+
+// Match 返回实例是否满足selector中的每一项，version和zone也可以作为selector的key
+func (s *ServerItem) Match(selector map[string]string) bool {
+	for k,v := range selector {
+		var got string
+		var ok bool
+		switch k {
+		case "version":
+			got,ok = s.Version,s.Version != ""
+		case "zone":
+			got,ok = s.Zone,s.Zone != ""
+		default:
+			got,ok = s.Tags[k]
+		}
+		if !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+//元数据是否相同，不比较心跳时间
+func (s *ServerItem) sameMeta(o *ServerItem) bool {
+	if s.Weight != o.Weight || s.Version != o.Version || s.Zone != o.Zone || len(s.Tags) != len(o.Tags) {
+		return false
+	}
+	for k,v := range s.Tags {
+		if ov,ok := o.Tags[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ServersResponse 是GET请求返回的JSON body
+type ServersResponse struct {
+	Revision uint64 `json:"revision"`
+	Servers []ServerItem `json:"servers"`
+}
+
 const (
 	defaultPath = "/_geerpc_/registry"
 	defaultTimeout = time.Minute * 5
+	defaultWatchWait = time.Second * 30 //watch请求在服务列表没有变化时最多挂起多久
 )
 
 func New(timeout time.Duration) *GeeRegistry {
 	return &GeeRegistry{
 		timeout: timeout,
-		servers: make(map[string]*ServerItem),
+		servers: make(map[serverKey]*ServerItem),
+		changed: make(chan struct{}),
+		deleted: make(map[serverKey]time.Time),
+		probes: make(map[string]*probeState),
 	}
 }
 
 var DefaultGeeRegistry = New(defaultTimeout)
 
-func (r *GeeRegistry) putServer(addr string) {
+//服务列表发生了变化，调用方需要持有r.mu
+func (r *GeeRegistry) bump() {
+	r.revision++
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *GeeRegistry) putServer(item ServerItem) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	
-	s := r.servers[addr]
-	if s == nil {
-		r.servers[addr] = &ServerItem{
-			Addr: addr,
-			start: time.Now(),
-		}
+	key := serverKey{item.Service,item.Addr}
+	item.start = time.Now()
+	delete(r.deleted,key)
+	s := r.servers[key]
+	if s == nil || !s.sameMeta(&item) {
+		r.servers[key] = &item
+		r.bump()
 	} else {
-		s.start = time.Now()
+		s.start = item.start
 	}
+	//心跳也要记录，重启后才能按原来的租约过期
+	r.persist(opPut,&item)
 }
 
-func (r *GeeRegistry) aliveServers() []string {
+//注销实例，实例不存在时返回false
+func (r *GeeRegistry) removeServer(item ServerItem) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	
-	var alive []string
-	
+
+	key := serverKey{item.Service,item.Addr}
+	if _,ok := r.servers[key]; !ok {
+		return false
+	}
+	delete(r.servers,key)
+	r.deleted[key] = time.Now()
+	r.bump()
+	r.persist(opDelete,&item)
+	return true
+}
+
+//返回按地址、服务名排序的存活服务和当前的revision，同时删除过期的服务。
+//expiry是最早过期的服务的过期时间，没有服务会过期时为零值。调用方需要持有r.mu
+func (r *GeeRegistry) aliveLocked() (alive []ServerItem,revision uint64,expiry time.Time) {
+	now := time.Now()
+	removed := false
 	for addr,s := range r.servers {
-		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
-			alive = append(alive,addr)
+		if r.timeout == 0 {
+			alive = append(alive,*s)
+			continue
+		}
+		deadline := s.start.Add(r.timeout)
+		if deadline.After(now) {
+			alive = append(alive,*s)
+			if expiry.IsZero() || deadline.Before(expiry) {
+				expiry = deadline
+			}
 		}else{
 			delete(r.servers,addr)
+			removed = true
+		}
+	}
+	if removed {
+		r.bump()
+	}
+	//注销记录保留一个租约的时间，之后被注销的实例在其他节点上也已经过期
+	for key,at := range r.deleted {
+		if now.Sub(at) > r.tombstoneTTL() {
+			delete(r.deleted,key)
 		}
 	}
 	
-	sort.Strings(alive)
+	sort.Slice(alive,func(i, j int) bool {
+		if alive[i].Addr != alive[j].Addr {
+			return alive[i].Addr < alive[j].Addr
+		}
+		return alive[i].Service < alive[j].Service
+	})
 	
-	return alive
+	return alive,r.revision,expiry
+}
+
+//返回按地址、服务名排序的存活服务和当前的revision
+func (r *GeeRegistry) aliveServers() ([]ServerItem,uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	alive,revision,_ := r.aliveLocked()
+	return alive,revision
+}
+
+// watch 在revision与当前的revision不同时立即返回服务列表，否则挂起直到服务列表变化、
+// 有服务过期、等待了wait或者ctx结束
+func (r *GeeRegistry) watch(ctx context.Context,revision uint64,wait time.Duration) ([]ServerItem,uint64) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		r.mu.Lock()
+		alive,cur,expiry := r.aliveLocked()
+		changed := r.changed
+		r.mu.Unlock()
+		if cur != revision {
+			return alive,cur
+		}
+
+		//过期是在读取时才发现的，需要在最早的过期时间醒来检查一次
+		var expired <-chan time.Time
+		var expireTimer *time.Timer
+		if !expiry.IsZero() {
+			expireTimer = time.NewTimer(time.Until(expiry))
+			expired = expireTimer.C
+		}
+		stop := false
+		select {
+		case <-changed:
+		case <-expired:
+		case <-timer.C:
+			stop = true
+		case <-ctx.Done():
+			stop = true
+		}
+		if expireTimer != nil {
+			expireTimer.Stop()
+		}
+		if stop {
+			return alive,cur
+		}
+	}
 }
 
 func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case "GET":
-		w.Header().Set("X-Geerpc-Servers",strings.Join(r.aliveServers(),","))
+		//带revision参数的请求是watch请求，服务列表相对于该revision没有变化时挂起
+		var alive []ServerItem
+		var revision uint64
+		if rev := req.URL.Query().Get("revision"); rev != "" {
+			since,err := strconv.ParseUint(rev,10,64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			wait := defaultWatchWait
+			if v := req.URL.Query().Get("wait"); v != "" {
+				if d,err := time.ParseDuration(v); err == nil && d > 0 && d < wait {
+					wait = d
+				}
+			}
+			alive,revision = r.watch(req.Context(),since,wait)
+		} else {
+			alive,revision = r.aliveServers()
+		}
+		//带service参数时只返回提供该服务的实例，主动探测失败的实例不返回
+		service := req.URL.Query().Get("service")
+		alive = r.filterHealthy(alive)
+		if service != "" {
+			matched := alive[:0]
+			for _,s := range alive {
+				if s.Serves(service) {
+					matched = append(matched,s)
+				}
+			}
+			alive = matched
+		}
+
+		//兼容只认header的老版本Discovery，同一个地址只出现一次
+		addrs := make([]string,0,len(alive))
+		weights := make([]string,0,len(alive))
+		seen := make(map[string]bool,len(alive))
+		for _,s := range alive {
+			if seen[s.Addr] {
+				continue
+			}
+			seen[s.Addr] = true
+			addrs = append(addrs,s.Addr)
+			weights = append(weights,strconv.Itoa(s.Weight))
+		}
+		w.Header().Set("X-Geerpc-Servers",strings.Join(addrs,","))
+		w.Header().Set("X-Geerpc-Weights",strings.Join(weights,","))
+		w.Header().Set("X-Geerpc-Revision",strconv.FormatUint(revision,10))
+		w.Header().Set("Content-Type","application/json")
+		if alive == nil {
+			alive = []ServerItem{}
+		}
+		_ = json.NewEncoder(w).Encode(&ServersResponse{Revision: revision,Servers: alive})
 	case "POST":
-		addr := req.Header.Get("X-Geerpc-Server")
-		if addr == "" {
-			w.WriteHeader(http.StatusInternalServerError)
+		if req.URL.Query().Get("sync") != "" {
+			r.handleSync(w,req)
+			return
+		}
+		item,status := readItem(req)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		r.putServer(item)
+	case "DELETE":
+		item,status := readItem(req)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
 			return
 		}
-		r.putServer(addr)
+		if !r.removeServer(item) {
+			w.WriteHeader(http.StatusNotFound)
+		}
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -86,37 +314,33 @@ func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 func (r *GeeRegistry) HandleHTTP(registryPath string) {
 	http.Handle(registryPath,r)
-	log.Printf("rpc registry path: ",registryPath)
+	log.Println("rpc registry path: ",registryPath)
 }
 
 func HandleHTTP() {
 	DefaultGeeRegistry.HandleHTTP(defaultPath)
 }
 
-func Heartbeat(registry, addr string, duration time.Duration) {
-	if duration == 0 {
-		duration = defaultTimeout - time.Minute * 1
-	}
+// Close 停止集群同步和主动探测，压缩并关闭持久化文件
+func (r *GeeRegistry) Close() error {
+	r.leaveCluster()
+	r.SetProbePolicy(nil)
+	return r.closeStore()
+}
 
-	var err error
-	err = sendHeartbeat(registry,addr)
-	go func() {
-		t := time.NewTicker(duration)
-		for err == nil {
-			<- t.C
-			err = sendHeartbeat(registry,addr)
-		}
-	}()
-}
-
-func sendHeartbeat(registry, addr string) error {
-	log.Println(addr,"send heart beat to registry",registry)
-	httpClient := &http.Client{}
-	req,_ := http.NewRequest("POST",registry,nil)
-	req.Header.Set("X-Geerpc-Server",addr)
-	if _,err := httpClient.Do(req);err!=nil {
-		log.Println("rpc server: heart beat err:",err)
-		return err
+//从POST或DELETE请求中读取实例，JSON body或老版本的header都可以
+func readItem(req *http.Request) (ServerItem,int) {
+	var item ServerItem
+	if strings.HasPrefix(req.Header.Get("Content-Type"),"application/json") {
+		if err := json.NewDecoder(req.Body).Decode(&item);err != nil || item.Addr == "" {
+			return item,http.StatusBadRequest
+		}
+		return item,http.StatusOK
+	}
+	item.Addr = req.Header.Get("X-Geerpc-Server")
+	if item.Addr == "" {
+		return item,http.StatusInternalServerError
 	}
-	return nil
-}
\ No newline at end of file
+	item.Weight,_ = strconv.Atoi(req.Header.Get("X-Geerpc-Weight"))
+	return item,http.StatusOK
+}
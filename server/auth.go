@@ -0,0 +1,215 @@
+package server
+
+import (
+	"GeekRPC/codec"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+)
+
+// 认证握手在Option之后进行，只在Option.Handshake为true时发生：
+//
+//	服务端 -> 客户端 AuthChallenge
+//	客户端 -> 服务端 AuthRequest
+//	服务端 -> 客户端 AuthResult
+//
+// 服务端的消息不带换行符，客户端读完AuthResult后连接上不会残留多余的数据
+
+// AuthRequest 是客户端根据challenge生成的认证请求
+type AuthRequest struct {
+	Scheme   string `json:"scheme"`             //认证方式，如"bearer"、"hmac"
+	Identity string `json:"identity,omitempty"` //声称的身份，如HMAC密钥的ID
+	Token    []byte `json:"token,omitempty"`
+}
+
+// AuthChallenge 是服务端发给客户端的challenge，每个连接随机生成
+type AuthChallenge struct {
+	Challenge []byte `json:"challenge"`
+}
+
+// AuthResult 是服务端返回的认证结果，Error不为空表示认证失败
+type AuthResult struct {
+	Principal string `json:"principal,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Code      int    `json:"code,omitempty"`
+}
+
+// Authenticator 在连接建立时认证客户端，返回的principal会放到该连接上每个请求的ctx中。
+// ctx中带有连接的对端信息，可以与mutual TLS一起使用
+type Authenticator interface {
+	Authenticate(ctx context.Context, challenge []byte, req *AuthRequest) (principal string, err error)
+}
+
+// AuthenticatorFunc 把函数转换成Authenticator
+type AuthenticatorFunc func(ctx context.Context, challenge []byte, req *AuthRequest) (string, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, challenge []byte, req *AuthRequest) (string, error) {
+	return f(ctx, challenge, req)
+}
+
+// Credentials 是客户端的认证信息，设置在Option.Credentials中
+type Credentials interface {
+	Respond(challenge []byte) (*AuthRequest, error)
+}
+
+// CredentialsFunc 把函数转换成Credentials
+type CredentialsFunc func(challenge []byte) (*AuthRequest, error)
+
+func (f CredentialsFunc) Respond(challenge []byte) (*AuthRequest, error) {
+	return f(challenge)
+}
+
+const (
+	SchemeBearer = "bearer"
+	SchemeHMAC   = "hmac"
+)
+
+// BearerToken 返回直接发送token的Credentials，应当只在TLS连接上使用
+func BearerToken(token string) Credentials {
+	return CredentialsFunc(func([]byte) (*AuthRequest, error) {
+		return &AuthRequest{Scheme: SchemeBearer, Token: []byte(token)}, nil
+	})
+}
+
+// HMACCredentials 返回用secret对challenge计算HMAC-SHA256的Credentials，secret不会在网络上传输
+func HMACCredentials(keyID string, secret []byte) Credentials {
+	return CredentialsFunc(func(challenge []byte) (*AuthRequest, error) {
+		return &AuthRequest{Scheme: SchemeHMAC, Identity: keyID, Token: hmacSum(secret, challenge)}, nil
+	})
+}
+
+func hmacSum(secret, challenge []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
+
+var errUnauthenticated = NewError(CodeUnauthenticated, "rpc server: unauthenticated")
+
+// TokenAuthenticator 认证bearer token，tokens是token到principal的映射
+func TokenAuthenticator(tokens map[string]string) Authenticator {
+	return AuthenticatorFunc(func(_ context.Context, _ []byte, req *AuthRequest) (string, error) {
+		if req.Scheme != SchemeBearer {
+			return "", errUnauthenticated
+		}
+		for token, principal := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), req.Token) == 1 {
+				return principal, nil
+			}
+		}
+		return "", errUnauthenticated
+	})
+}
+
+// HMACAuthenticator 认证HMACCredentials，keys是密钥ID到secret的映射，principal为密钥ID
+func HMACAuthenticator(keys map[string][]byte) Authenticator {
+	return AuthenticatorFunc(func(_ context.Context, challenge []byte, req *AuthRequest) (string, error) {
+		secret, ok := keys[req.Identity]
+		if req.Scheme != SchemeHMAC || !ok || !hmac.Equal(hmacSum(secret, challenge), req.Token) {
+			return "", errUnauthenticated
+		}
+		return req.Identity, nil
+	})
+}
+
+// SetAuthenticator 设置认证方式，之后建立的连接都需要通过认证，为nil时不认证
+func (server *Server) SetAuthenticator(auth Authenticator) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.auth = auth
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext 返回连接认证通过的principal，ctx是服务方法收到的ctx
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(principalKey{}).(string)
+	return p, ok
+}
+
+const authTimeout = time.Second * 10
+
+// 在Option之后认证连接，返回带有principal的ctx。没有设置Authenticator时不需要认证，
+// 客户端发起了握手也直接通过
+func (server *Server) authenticate(ctx context.Context, conn io.ReadWriteCloser, dec *json.Decoder, opt *Option) (context.Context, error) {
+	server.mu.Lock()
+	auth := server.auth
+	server.mu.Unlock()
+	if !opt.Handshake {
+		if auth != nil {
+			return ctx, NewError(CodeUnauthenticated, "rpc server: authentication required")
+		}
+		return ctx, nil
+	}
+	if c, ok := conn.(net.Conn); ok {
+		_ = c.SetDeadline(time.Now().Add(authTimeout))
+		defer func() { _ = c.SetDeadline(time.Time{}) }()
+	}
+
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return ctx, err
+	}
+	if err := writeJSON(conn, &AuthChallenge{Challenge: challenge}); err != nil {
+		return ctx, err
+	}
+	var req AuthRequest
+	if err := dec.Decode(&req); err != nil {
+		return ctx, err
+	}
+
+	var result AuthResult
+	var err error
+	if auth != nil {
+		result.Principal, err = auth.Authenticate(ctx, challenge, &req)
+	}
+	if err != nil {
+		code := CodeOf(err)
+		if code == CodeUnknown {
+			code = CodeUnauthenticated
+		}
+		result.Error, result.Code = err.Error(), int(code)
+		err = NewError(code, err.Error())
+	}
+	if werr := writeJSON(conn, &result); werr != nil && err == nil {
+		err = werr
+	}
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, principalKey{}, result.Principal), nil
+}
+
+// 不带换行符地写入一条握手消息
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// 拒绝没有通过认证的连接：丢弃每个请求并返回err，直到客户端断开
+func (server *Server) reject(cc codec.Codec, err error) {
+	for {
+		h, rerr := server.readRequestHeader(cc)
+		if rerr != nil {
+			break
+		}
+		if rerr = cc.ReadBody(nil); rerr != nil {
+			break
+		}
+		h.Error, h.Code, h.Metadata = err.Error(), int(CodeOf(err)), nil
+		if rerr = cc.Write(h, invalidRequest); rerr != nil {
+			break
+		}
+	}
+	_ = cc.Close()
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Authorizer 在调用服务方法之前决定调用方能否调用serviceMethod，返回错误时拒绝调用。
+// 没有显式错误码的错误按CodePermissionDenied返回给客户端
+type Authorizer interface {
+	Authorize(ctx context.Context, serviceMethod string) error
+}
+
+// AuthorizerFunc 把函数转换成Authorizer
+type AuthorizerFunc func(ctx context.Context, serviceMethod string) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, serviceMethod string) error {
+	return f(ctx, serviceMethod)
+}
+
+type authorizerHolder struct {
+	Authorizer
+}
+
+// SetAuthorizer 设置授权方式，对之后的每个请求生效，为nil时不检查。
+// 内置的Ping和Health服务的Check、Watch不需要授权，但仍然需要认证：设置了Authenticator时，
+// 注册中心需要在ProbePolicy.Option中带上Credentials才能探测
+func (server *Server) SetAuthorizer(a Authorizer) {
+	server.authz.Store(authorizerHolder{a})
+}
+
+// 检查ctx中的调用方能否调用serviceMethod
+func (server *Server) authorize(ctx context.Context, svc *Service, serviceMethod string) error {
+	h, _ := server.authz.Load().(authorizerHolder)
+	if h.Authorizer == nil || exemptFromAuthz(svc, serviceMethod) {
+		return nil
+	}
+	err := h.Authorize(ctx, serviceMethod)
+	if err != nil && CodeOf(err) == CodeUnknown {
+		err = NewError(CodePermissionDenied, err.Error())
+	}
+	return err
+}
+
+// 不需要授权的方法：只有内置服务的Ping和RegisterHealth注册的Health服务的Check、Watch，
+// 用户以同样的服务名注册的服务和方法仍然需要授权
+func exemptFromAuthz(svc *Service, serviceMethod string) bool {
+	switch serviceMethod {
+	case PingMethod:
+		return svc.isBuiltin()
+	case HealthCheckMethod, HealthWatchMethod:
+		return svc.isHealth()
+	}
+	return false
+}
+
+// CallerFromContext 返回调用方的身份：认证握手得到的principal，没有握手时为客户端证书的身份，都没有时为空
+func CallerFromContext(ctx context.Context) string {
+	if p, ok := PrincipalFromContext(ctx); ok && p != "" {
+		return p
+	}
+	if p, ok := PeerFromContext(ctx); ok {
+		return p.Identity()
+	}
+	return ""
+}
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy 是基于规则的授权策略，可以从JSON文件加载：
+//
+//	{
+//	  "default": "deny",
+//	  "roles": {"alice": ["admin"], "bob": ["reader"]},
+//	  "rules": [
+//	    {"effect": "allow", "roles": ["admin"], "methods": ["*"]},
+//	    {"effect": "allow", "roles": ["reader"], "methods": ["Arith.Get*", "Reflection.*"]},
+//	    {"effect": "deny", "principals": ["mallory"], "methods": ["*"]}
+//	  ]
+//	}
+//
+// 有匹配的deny规则时拒绝，否则有匹配的allow规则时允许，都没有时按Default处理
+type Policy struct {
+	Default string              `json:"default,omitempty"` //allow或deny，为空时是deny
+	Roles   map[string][]string `json:"roles,omitempty"`   //principal拥有的角色
+	Rules   []Rule              `json:"rules"`
+}
+
+// Rule 是一条授权规则
+type Rule struct {
+	Effect     string   `json:"effect"`               //allow或deny
+	Principals []string `json:"principals,omitempty"` //"*"匹配任意已认证的调用方
+	Roles      []string `json:"roles,omitempty"`      //Principals和Roles都为空时匹配所有调用方，包括未认证的
+	Methods    []string `json:"methods"`              //Service.Method，可以使用path.Match的通配符，如"Arith.*"
+}
+
+// ParsePolicy 解析并检查JSON格式的策略
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	if p.Default != "" && p.Default != EffectAllow && p.Default != EffectDeny {
+		return fmt.Errorf("rpc authz: invalid default effect %q", p.Default)
+	}
+	for i, r := range p.Rules {
+		if r.Effect != EffectAllow && r.Effect != EffectDeny {
+			return fmt.Errorf("rpc authz: rule %d: invalid effect %q", i, r.Effect)
+		}
+		if len(r.Methods) == 0 {
+			return fmt.Errorf("rpc authz: rule %d: no methods", i)
+		}
+		for _, m := range r.Methods {
+			if _, err := path.Match(m, ""); err != nil {
+				return fmt.Errorf("rpc authz: rule %d: invalid method pattern %q", i, m)
+			}
+		}
+	}
+	return nil
+}
+
+// Authorize 按规则检查ctx中的调用方（见CallerFromContext）能否调用serviceMethod
+func (p *Policy) Authorize(ctx context.Context, serviceMethod string) error {
+	caller := CallerFromContext(ctx)
+	allowed := p.Default == EffectAllow
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.matchMethod(serviceMethod) || !r.matchCaller(caller, p.Roles[caller]) {
+			continue
+		}
+		if r.Effect == EffectDeny {
+			allowed = false
+			break
+		}
+		allowed = true
+	}
+	if !allowed {
+		if caller == "" {
+			caller = "anonymous caller"
+		}
+		return Errorf(CodePermissionDenied, "rpc server: %s is not allowed to call %s", caller, serviceMethod)
+	}
+	return nil
+}
+
+func (r *Rule) matchMethod(serviceMethod string) bool {
+	for _, m := range r.Methods {
+		if ok, _ := path.Match(m, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchCaller(caller string, roles []string) bool {
+	if len(r.Principals) == 0 && len(r.Roles) == 0 {
+		return true
+	}
+	for _, p := range r.Principals {
+		if p == caller || p == "*" && caller != "" {
+			return true
+		}
+	}
+	for _, want := range r.Roles {
+		for _, role := range roles {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PolicyFile 是从文件加载的Policy，文件修改后自动重新加载。
+// 新的文件无法解析时继续使用原来的策略
+type PolicyFile struct {
+	path    string
+	policy  atomic.Value //*Policy
+	modTime time.Time
+	mu      sync.Mutex //串行化重新加载
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// LoadPolicyFile 加载filename中的策略，并每隔interval检查一次文件是否被修改，interval为0时不自动重新加载
+func LoadPolicyFile(filename string, interval time.Duration) (*PolicyFile, error) {
+	f := &PolicyFile{path: filename}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		f.cancel = cancel
+		f.done = make(chan struct{})
+		go f.watchLoop(ctx, interval)
+	}
+	return f, nil
+}
+
+// Reload 立即重新加载文件，可以在收到SIGHUP等信号时调用
+func (f *PolicyFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.policy.Store(p)
+	f.modTime = info.ModTime()
+	return nil
+}
+
+// Policy 返回当前生效的策略
+func (f *PolicyFile) Policy() *Policy {
+	return f.policy.Load().(*Policy)
+}
+
+func (f *PolicyFile) Authorize(ctx context.Context, serviceMethod string) error {
+	return f.Policy().Authorize(ctx, serviceMethod)
+}
+
+// Close 停止自动重新加载
+func (f *PolicyFile) Close() error {
+	if f.cancel != nil {
+		f.cancel()
+		<-f.done
+	}
+	return nil
+}
+
+func (f *PolicyFile) watchLoop(ctx context.Context, interval time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(f.path)
+		if err != nil {
+			log.Println("rpc authz: stat policy file error:", err)
+			continue
+		}
+		f.mu.Lock()
+		changed := !info.ModTime().Equal(f.modTime)
+		f.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := f.Reload(); err != nil {
+			log.Println("rpc authz: reload policy error, keep the old policy:", err)
+			//记录下这次的修改时间，文件再次修改前不重复报错
+			f.mu.Lock()
+			f.modTime = info.ModTime()
+			f.mu.Unlock()
+			continue
+		}
+		log.Println("rpc authz: reloaded policy from", f.path)
+	}
+}
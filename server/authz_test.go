@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPolicy = `{
+  "default": "deny",
+  "roles": {"alice": ["admin"], "bob": ["reader"], "carol": ["reader"]},
+  "rules": [
+    {"effect": "allow", "roles": ["admin"], "methods": ["*"]},
+    {"effect": "allow", "roles": ["reader"], "methods": ["Arith.Get*"]},
+    {"effect": "allow", "principals": ["*"], "methods": ["Reflection.*"]},
+    {"effect": "allow", "methods": ["Public.*"]},
+    {"effect": "deny", "principals": ["carol"], "methods": ["Arith.GetSecret"]}
+  ]
+}`
+
+func withPrincipal(p string) context.Context {
+	return context.WithValue(context.Background(), principalKey{}, p)
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//没有握手时使用客户端证书的身份
+	certCtx := context.WithValue(context.Background(), peerKey{}, &Peer{TLS: &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "bob"}}},
+	}})
+	tests := []struct {
+		ctx    context.Context
+		method string
+		allow  bool
+	}{
+		{withPrincipal("alice"), "Arith.Set", true},
+		{withPrincipal("bob"), "Arith.GetSum", true},
+		{withPrincipal("bob"), "Arith.Set", false},
+		{withPrincipal("carol"), "Arith.GetSum", true},
+		{withPrincipal("carol"), "Arith.GetSecret", false},
+		{withPrincipal("dave"), "Reflection.ListServices", true},
+		{context.Background(), "Reflection.ListServices", false},
+		{context.Background(), "Public.Echo", true},
+		{context.Background(), "Arith.GetSum", false},
+		{certCtx, "Arith.GetSum", true},
+	}
+	for _, tt := range tests {
+		err := p.Authorize(tt.ctx, tt.method)
+		if (err == nil) != tt.allow {
+			t.Fatalf("%s calling %s: expect allow=%v, got %v", CallerFromContext(tt.ctx), tt.method, tt.allow, err)
+		}
+		if err != nil && CodeOf(err) != CodePermissionDenied {
+			t.Fatalf("expect permission denied, got %v", err)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"default": "maybe"}`,
+		`{"rules": [{"effect": "permit", "methods": ["*"]}]}`,
+		`{"rules": [{"effect": "allow"}]}`,
+		`{"rules": [{"effect": "allow", "methods": ["Arith.["]}]}`,
+	} {
+		if _, err := ParsePolicy([]byte(bad)); err == nil {
+			t.Fatalf("expect error for %s", bad)
+		}
+	}
+}
+
+func TestServer_AuthorizeBuiltin(t *testing.T) {
+	srv := NewServer()
+	_ = srv.Register(new(Foo))
+	srv.SetAuthorizer(&Policy{})
+	ctx := context.Background()
+	for _, method := range []string{PingMethod, "Foo.Sum"} {
+		svc, _, err := srv.findService(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = srv.authorize(ctx, svc, method)
+		if allow := method == PingMethod; (err == nil) != allow {
+			t.Fatalf("%s: expect allow=%v, got %v", method, allow, err)
+		}
+	}
+
+	//只有真正的内置服务和Health服务上的几个方法免于授权
+	_, _ = srv.RegisterHealth()
+	_ = RegisterFunc(srv, "Health.Reset", func(ctx context.Context, _ int) (bool, error) { return true, nil })
+	_ = RegisterFunc(srv, "GeeRPC.Shutdown", func(ctx context.Context, _ int) (bool, error) { return true, nil })
+	for method, allow := range map[string]bool{
+		HealthCheckMethod: true, HealthWatchMethod: true, "Health.Reset": false, "GeeRPC.Shutdown": false, PingMethod: true,
+	} {
+		svc, _, err := srv.findService(method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = srv.authorize(ctx, svc, method); (err == nil) != allow {
+			t.Fatalf("%s: expect allow=%v, got %v", method, allow, err)
+		}
+	}
+	//用户以Health为名注册的服务不免于授权
+	fake := NewServer()
+	_ = fake.RegisterName("Health", new(Foo))
+	fake.SetAuthorizer(&Policy{})
+	if svc, _, err := fake.findService("Health.Sum"); err != nil || fake.authorize(ctx, svc, "Health.Sum") == nil {
+		t.Fatalf("expect user service named Health to be authorized, got %v", err)
+	}
+
+	srv.SetAuthorizer(nil)
+	svc, _, _ := srv.findService("Foo.Sum")
+	if err := srv.authorize(ctx, svc, "Foo.Sum"); err != nil {
+		t.Fatalf("expect no authorization after SetAuthorizer(nil), got %v", err)
+	}
+}
+
+func TestPolicyFile_Reload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.json")
+	write := func(s string, mtime time.Time) {
+		if err := os.WriteFile(filename, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(filename, mtime, mtime)
+	}
+	write(`{"rules": [{"effect": "allow", "principals": ["alice"], "methods": ["*"]}]}`, time.Now().Add(-time.Minute))
+	f, err := LoadPolicyFile(filename, time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Authorize(withPrincipal("alice"), "Foo.Sum") != nil || f.Authorize(withPrincipal("bob"), "Foo.Sum") == nil {
+		t.Fatal("unexpected initial policy")
+	}
+
+	waitPolicy := func(principal string, allow bool) {
+		deadline := time.Now().Add(time.Second)
+		for (f.Authorize(withPrincipal(principal), "Foo.Sum") == nil) != allow {
+			if time.Now().After(deadline) {
+				t.Fatalf("policy for %s was not reloaded", principal)
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	write(`{"rules": [{"effect": "allow", "principals": ["bob"], "methods": ["*"]}]}`, time.Now().Add(-time.Second*30))
+	waitPolicy("bob", true)
+	waitPolicy("alice", false)
+
+	//无法解析的文件不影响当前的策略
+	write(`{"rules": [`, time.Now())
+	time.Sleep(time.Millisecond * 50)
+	if f.Authorize(withPrincipal("bob"), "Foo.Sum") != nil {
+		t.Fatal("broken policy file should keep the old policy")
+	}
+	if _, err := LoadPolicyFile(filename, 0); err == nil {
+		t.Fatal("expect error loading a broken policy file")
+	}
+}
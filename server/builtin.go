@@ -0,0 +1,21 @@
+package server
+
+import "reflect"
+
+const builtinServiceName = "GeeRPC"
+
+// PingMethod 是每个Server都提供的内置方法，参数为int，reply为*bool，
+// 注册中心通过它确认服务能正常处理请求
+const PingMethod = builtinServiceName + ".Ping"
+
+type builtin struct{}
+
+func (builtin) Ping(_ int, reply *bool) error {
+	*reply = true
+	return nil
+}
+
+// 是否是NewServer注册的内置服务，而不是用户以同样的名字注册的服务
+func (s *Service) isBuiltin() bool {
+	return s.rcvr.IsValid() && s.rcvr.Type() == reflect.TypeOf(builtin{})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// RegisterFunc 把普通函数fn注册为serviceMethod（形如"Foo.Sum"），不需要定义带方法的结构体。
+// 调用时直接调用fn，不经过reflect.Value.Call；ctx在请求超时后取消，并带有请求的元数据。
+// 服务已经存在时把方法加到该服务上，方法已经存在时返回错误
+func RegisterFunc[Req, Resp any](server *Server, serviceMethod string, fn func(context.Context, Req) (Resp, error)) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return errors.New("rpc: serviceMethod should be Service.Method: " + serviceMethod)
+	}
+	name, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	if !ast.IsExported(name) || !ast.IsExported(methodName) {
+		return errors.New("rpc: serviceMethod is not exported: " + serviceMethod)
+	}
+	argType, replyType := reflect.TypeOf((*Req)(nil)).Elem(), reflect.TypeOf((*Resp)(nil))
+	if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType.Elem()) {
+		return errors.New("rpc: argument or reply type is not exported: " + serviceMethod)
+	}
+	mtype := &MethodType{
+		ArgType:   argType,
+		ReplyType: replyType,
+		fn: func(ctx context.Context, argv, replyv interface{}) error {
+			resp, err := fn(ctx, argv.(Req))
+			if err != nil {
+				return err
+			}
+			*replyv.(*Resp) = resp
+			return nil
+		},
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	//已经注册的service可能正在处理请求，复制一份再替换，不修改原来的method
+	s := &Service{name: name, method: make(map[string]*MethodType)}
+	if v, ok := server.ServiceMap.Load(name); ok {
+		old := v.(*Service)
+		if old.method[methodName] != nil {
+			return errors.New("rpc: method already defined: " + serviceMethod)
+		}
+		s.typ, s.rcvr = old.typ, old.rcvr
+		for k, m := range old.method {
+			s.method[k] = m
+		}
+	}
+	s.method[methodName] = mtype
+	server.ServiceMap.Store(name, s)
+	log.Printf("rpc server: register %s\n", serviceMethod)
+	return nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	srv := NewServer()
+	_ = srv.Register(new(Foo))
+	double := func(ctx context.Context, n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * 2, nil
+	}
+	if err := RegisterFunc(srv, "Foo.Double", double); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterFunc(srv, "Foo.Double", double); err == nil {
+		t.Fatal("expect error for duplicate method")
+	}
+	if err := RegisterFunc(srv, "Foo.Sum", double); err == nil {
+		t.Fatal("expect error for method defined by the receiver")
+	}
+	for _, name := range []string{"Double", "foo.Double", "Foo.double"} {
+		if err := RegisterFunc(srv, name, double); err == nil {
+			t.Fatalf("expect error for %s", name)
+		}
+	}
+
+	//原来的方法仍然可用
+	svc, mtype, err := srv.findService("Foo.Sum")
+	_assert(err == nil && mtype.fn == nil, "Foo.Sum should still be a reflective method")
+	svc, mtype, err = srv.findService("Foo.Double")
+	_assert(err == nil && mtype.fn != nil, "Foo.Double should be registered")
+
+	argv, replyv := mtype.newArgv(), mtype.newReplyv()
+	argv.Set(reflect.ValueOf(21))
+	_assert(svc.call(context.Background(), mtype, argv, replyv) == nil, "call Foo.Double failed")
+	_assert(*replyv.Interface().(*int) == 42, "expect 42, got %d", *replyv.Interface().(*int))
+	argv.Set(reflect.ValueOf(-1))
+	_assert(svc.call(context.Background(), mtype, argv, replyv) != nil, "expect error for negative input")
+	_assert(mtype.NumCalls() == 2, "expect 2 calls, got %d", mtype.NumCalls())
+
+	schema := describeService(svc)
+	_assert(len(schema.Methods) == 2 && schema.Methods[0].Name == "Double", "reflection should describe Foo.Double")
+}
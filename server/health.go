@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ServingStatus 是服务的健康状态，语义与标准的health check相同
+type ServingStatus int
+
+const (
+	StatusUnknown        ServingStatus = iota
+	StatusServing                      //可以正常处理请求
+	StatusNotServing                   //暂时不能处理请求，例如正在关闭
+	StatusServiceUnknown               //只出现在Watch中，表示服务没有设置过状态
+)
+
+func (s ServingStatus) String() string {
+	switch s {
+	case StatusServing:
+		return "SERVING"
+	case StatusNotServing:
+		return "NOT_SERVING"
+	case StatusServiceUnknown:
+		return "SERVICE_UNKNOWN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+const (
+	healthServiceName = "Health"
+	HealthCheckMethod = healthServiceName + ".Check"
+	HealthWatchMethod = healthServiceName + ".Watch"
+)
+
+// Watch最多等待多久，要小于服务端的处理超时handleTimeout，否则等满之前就会被取消。测试时可以修改
+var maxHealthWatchWait = time.Second * 5
+
+type HealthCheckRequest struct {
+	Service string //为空表示整个Server的状态
+}
+
+type HealthCheckResponse struct {
+	Status ServingStatus
+}
+
+type HealthWatchRequest struct {
+	Service string
+	Status  ServingStatus //调用方已知的状态，状态与它不同时Watch立即返回
+	Wait    time.Duration //状态没有变化时最多等待多久，0或者超过5秒时按5秒
+}
+
+// HealthServer 保存各个服务的健康状态，由应用设置
+type HealthServer struct {
+	mu       sync.Mutex
+	statuses map[string]ServingStatus
+	changed  chan struct{} //状态变化时关闭并替换，用来唤醒Watch
+}
+
+func newHealthServer() *HealthServer {
+	return &HealthServer{
+		statuses: map[string]ServingStatus{"": StatusServing},
+		changed:  make(chan struct{}),
+	}
+}
+
+// RegisterHealth 在server上注册Health服务并返回它，整个Server的初始状态为SERVING。
+// 重复调用返回同一个HealthServer，已经有其他服务以Health为名注册时返回错误
+func (server *Server) RegisterHealth() (*HealthServer, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if v, ok := server.ServiceMap.Load(healthServiceName); ok {
+		s := v.(*Service)
+		if !s.isHealth() {
+			return nil, errors.New("rpc: Service already defined: " + healthServiceName)
+		}
+		return s.rcvr.Interface().(*HealthServer), nil
+	}
+	h := newHealthServer()
+	server.ServiceMap.Store(healthServiceName, newNamedService(healthServiceName, h))
+	return h, nil
+}
+
+// 是否是RegisterHealth注册的Health服务，而不是用户以同样的名字注册的服务
+func (s *Service) isHealth() bool {
+	if !s.rcvr.IsValid() {
+		return false
+	}
+	_, ok := s.rcvr.Interface().(*HealthServer)
+	return ok
+}
+
+// RegisterHealth 在DefaultServer上注册Health服务
+func RegisterHealth() (*HealthServer, error) {
+	return DefaultServer.RegisterHealth()
+}
+
+// SetServingStatus 设置service的状态，service为空表示整个Server
+func (h *HealthServer) SetServingStatus(service string, status ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if old, ok := h.statuses[service]; ok && old == status {
+		return
+	}
+	h.statuses[service] = status
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Shutdown 把所有服务设置为NOT_SERVING，之后Check不再返回SERVING，通常在优雅退出前调用
+func (h *HealthServer) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for service := range h.statuses {
+		h.statuses[service] = StatusNotServing
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Resume 把所有服务设置为SERVING
+func (h *HealthServer) Resume() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for service := range h.statuses {
+		h.statuses[service] = StatusServing
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Check 返回服务的状态，服务没有设置过状态时返回CodeNotFound
+func (h *HealthServer) Check(req HealthCheckRequest, resp *HealthCheckResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status, ok := h.statuses[req.Service]
+	if !ok {
+		return Errorf(CodeNotFound, "rpc health: unknown service %q", req.Service)
+	}
+	resp.Status = status
+	return nil
+}
+
+// Watch 在服务的状态与req.Status不同时立即返回，否则等到状态变化或者等待超时后返回当前状态。
+// 服务没有设置过状态时返回SERVICE_UNKNOWN
+func (h *HealthServer) Watch(ctx context.Context, req HealthWatchRequest, resp *HealthCheckResponse) error {
+	wait := req.Wait
+	if wait <= 0 || wait > maxHealthWatchWait {
+		wait = maxHealthWatchWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		h.mu.Lock()
+		status, ok := h.statuses[req.Service]
+		if !ok {
+			status = StatusServiceUnknown
+		}
+		changed := h.changed
+		h.mu.Unlock()
+
+		resp.Status = status
+		if status != req.Status {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			//调用方已经离开或者请求超时，不再占用协程
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"GeekRPC/codec"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHealthServer_Check(t *testing.T) {
+	server := NewServer()
+	h, err := server.RegisterHealth()
+	_assert(err == nil, "RegisterHealth failed: %v", err)
+	h2, err := server.RegisterHealth()
+	_assert(err == nil && h2 == h, "RegisterHealth should return the same HealthServer")
+	//RegisterFunc在Health服务上添加方法后仍然是同一个HealthServer
+	_assert(RegisterFunc(server, "Health.Reset", func(ctx context.Context, _ int) (bool, error) { return true, nil }) == nil, "RegisterFunc failed")
+	h2, err = server.RegisterHealth()
+	_assert(err == nil && h2 == h, "RegisterHealth should return the same HealthServer after RegisterFunc")
+	_, mtype, err := server.findService(HealthCheckMethod)
+	_assert(err == nil && mtype != nil, "%s should be registered, got %v", HealthCheckMethod, err)
+
+	var resp HealthCheckResponse
+	_assert(h.Check(HealthCheckRequest{}, &resp) == nil && resp.Status == StatusServing, "server should be serving by default")
+	err = h.Check(HealthCheckRequest{Service: "Foo"}, &resp)
+	_assert(CodeOf(err) == CodeNotFound, "unknown service should be NotFound, got %v", err)
+
+	h.SetServingStatus("Foo", StatusServing)
+	h.Shutdown()
+	_ = h.Check(HealthCheckRequest{Service: "Foo"}, &resp)
+	_assert(resp.Status == StatusNotServing, "expect NOT_SERVING after Shutdown, got %s", resp.Status)
+	h.Resume()
+	_ = h.Check(HealthCheckRequest{}, &resp)
+	_assert(resp.Status == StatusServing, "expect SERVING after Resume, got %s", resp.Status)
+}
+
+func TestServer_RegisterHealthConflict(t *testing.T) {
+	//已经有其他服务以Health为名注册时返回错误，而不是panic
+	funcServer := NewServer()
+	_ = RegisterFunc(funcServer, "Health.X", func(ctx context.Context, _ int) (bool, error) { return true, nil })
+	h, err := funcServer.RegisterHealth()
+	_assert(h == nil && err != nil, "expect error when a func service named Health exists")
+
+	nameServer := NewServer()
+	_ = nameServer.RegisterName("Health", new(Foo))
+	h, err = nameServer.RegisterHealth()
+	_assert(h == nil && err != nil, "expect error when a user service named Health exists")
+}
+
+func TestHealthServer_Watch(t *testing.T) {
+	h := newHealthServer()
+	var resp HealthCheckResponse
+
+	//已知状态与当前不同时立即返回
+	_ = h.Watch(context.Background(), HealthWatchRequest{Status: StatusUnknown}, &resp)
+	_assert(resp.Status == StatusServing, "expect SERVING, got %s", resp.Status)
+	_ = h.Watch(context.Background(), HealthWatchRequest{Service: "Foo", Status: StatusUnknown}, &resp)
+	_assert(resp.Status == StatusServiceUnknown, "expect SERVICE_UNKNOWN, got %s", resp.Status)
+
+	//状态没有变化时等待
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		h.SetServingStatus("", StatusNotServing)
+	}()
+	start := time.Now()
+	_ = h.Watch(context.Background(), HealthWatchRequest{Status: StatusServing}, &resp)
+	_assert(resp.Status == StatusNotServing && time.Since(start) >= time.Millisecond*50,
+		"expect to wake up on change, got %s after %s", resp.Status, time.Since(start))
+
+	start = time.Now()
+	_ = h.Watch(context.Background(), HealthWatchRequest{Status: StatusNotServing, Wait: time.Millisecond * 30}, &resp)
+	_assert(resp.Status == StatusNotServing && time.Since(start) >= time.Millisecond*30, "expect to return after wait")
+}
+
+// 通过一个连接向server发送请求h，返回响应头，body读到reply中
+func rawCall(t *testing.T, server *Server, h *codec.Header, args, reply interface{}) *codec.Header {
+	conn, serverConn := net.Pipe()
+	defer func() { _ = conn.Close() }()
+	go server.ServeConn(serverConn)
+
+	_ = json.NewEncoder(conn).Encode(DefaultOption)
+	cc := codec.NewGobCodec(conn)
+	if err := cc.Write(h, args); err != nil {
+		t.Fatal(err)
+	}
+	var resp codec.Header
+	if err := cc.ReadHeader(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.ReadBody(reply); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func TestHealthServer_WatchDefaultWait(t *testing.T) {
+	oldTimeout, oldWait := handleTimeout, maxHealthWatchWait
+	handleTimeout, maxHealthWatchWait = time.Millisecond*100, time.Millisecond*50
+	t.Cleanup(func() { handleTimeout, maxHealthWatchWait = oldTimeout, oldWait })
+
+	server := NewServer()
+	_, _ = server.RegisterHealth()
+	//状态没有变化，Watch等满默认的等待时间后正常返回，而不是被处理超时打断
+	start := time.Now()
+	var resp HealthCheckResponse
+	h := rawCall(t, server, &codec.Header{ServiceMethod: HealthWatchMethod, Seq: 1}, HealthWatchRequest{Status: StatusServing}, &resp)
+	_assert(h.Error == "", "expect Watch to succeed, got %s", h.Error)
+	_assert(resp.Status == StatusServing && time.Since(start) >= maxHealthWatchWait,
+		"expect SERVING after the default wait, got %s after %s", resp.Status, time.Since(start))
+	_assert(maxHealthWatchWait < handleTimeout && oldWait < oldTimeout, "default Watch wait should be shorter than the handle timeout")
+}
+
+func TestHealthServer_WatchCanceled(t *testing.T) {
+	h := newHealthServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		cancel()
+	}()
+	start := time.Now()
+	var resp HealthCheckResponse
+	err := h.Watch(ctx, HealthWatchRequest{Status: StatusServing}, &resp)
+	_assert(err == context.Canceled && time.Since(start) < time.Second, "expect Watch to return on cancel, got %v after %s", err, time.Since(start))
+
+	//客户端断开后服务端的Watch也会结束
+	server := NewServer()
+	h, _ = server.RegisterHealth()
+	conn, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		server.ServeConn(serverConn)
+		close(done)
+	}()
+	_ = json.NewEncoder(conn).Encode(DefaultOption)
+	cc := codec.NewGobCodec(conn)
+	_ = cc.Write(&codec.Header{ServiceMethod: HealthWatchMethod, Seq: 1}, HealthWatchRequest{Status: StatusServing})
+	time.Sleep(time.Millisecond * 20)
+	_ = conn.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the connection to be released after the client leaves")
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import "context"
+
+type metadataKey struct{}
+
+func withMetadata(ctx context.Context, md map[string]string) context.Context {
+	if len(md) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext 返回客户端随请求发送的元数据，没有时返回nil。
+// ctx是RegisterFunc注册的函数收到的ctx
+func MetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+)
+
+// Peer 是发起请求的客户端连接的信息
+type Peer struct {
+	Addr net.Addr
+	TLS  *tls.ConnectionState //不是TLS连接时为nil
+}
+
+type peerKey struct{}
+
+// PeerFromContext 返回发起请求的客户端，ctx是服务方法收到的ctx
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// Certificate 返回客户端在mutual TLS握手中出示并通过校验的证书，没有时返回nil
+func (p *Peer) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return p.TLS.PeerCertificates[0]
+}
+
+// Identity 返回客户端证书表示的身份：CommonName，为空时依次取第一个URI和DNS名称。没有证书时返回空字符串
+func (p *Peer) Identity() string {
+	cert := p.Certificate()
+	switch {
+	case cert == nil:
+		return ""
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+const tlsHandshakeTimeout = time.Second * 10
+
+// AcceptTLS 与Accept相同，但是连接使用TLS。config中设置ClientAuth为tls.RequireAndVerifyClientCert
+// 和ClientCAs即可要求客户端出示证书（mutual TLS），服务方法通过PeerFromContext取得客户端的证书
+func (server *Server) AcceptTLS(lis net.Listener, config *tls.Config) {
+	server.Accept(tls.NewListener(lis, config))
+}
+
+// AcceptTLS 基于DefaultServer接收TLS连接
+func AcceptTLS(lis net.Listener, config *tls.Config) {
+	DefaultServer.AcceptTLS(lis, config)
+}
+
+// 握手并返回连接另一端的信息，TLS握手失败时返回错误
+func newPeer(conn net.Conn) (*Peer, error) {
+	p := &Peer{Addr: conn.RemoteAddr()}
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return p, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	p.TLS = &state
+	return p, nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"reflect"
+	"sort"
+)
+
+const (
+	reflectionServiceName    = "Reflection"
+	ReflectionListMethod     = reflectionServiceName + ".ListServices"
+	ReflectionDescribeMethod = reflectionServiceName + ".DescribeService"
+)
+
+// TypeSchema 描述一个参数或返回值的类型，可以用gob或json序列化
+type TypeSchema struct {
+	Name      string        //类型的完整名称，例如main.Args、*main.Args、[]string
+	Kind      string        //reflect.Kind的名称，例如struct、ptr、slice、map、int
+	Elem      *TypeSchema   //ptr、slice、array、map的元素类型
+	Key       *TypeSchema   //map的key类型
+	Len       int           //array的长度
+	Fields    []FieldSchema //struct的导出字段，只有导出字段会被编码
+	Recursive bool          //具名类型在外层已经出现过，不再展开
+}
+
+type FieldSchema struct {
+	Name string
+	Type *TypeSchema
+	Tag  string `json:",omitempty"`
+}
+
+type MethodSchema struct {
+	Name      string
+	ArgType   *TypeSchema
+	ReplyType *TypeSchema
+	NumCalls  uint64
+}
+
+type ServiceSchema struct {
+	Name    string
+	Methods []MethodSchema //按方法名排序
+}
+
+// Reflection 列出Server上注册的服务以及每个方法的参数和返回值类型
+type Reflection struct {
+	server *Server
+}
+
+// RegisterReflection 在server上注册Reflection服务，重复调用不会重复注册
+func (server *Server) RegisterReflection() {
+	_ = server.RegisterName(reflectionServiceName, &Reflection{server: server})
+}
+
+// RegisterReflection 在DefaultServer上注册Reflection服务
+func RegisterReflection() {
+	DefaultServer.RegisterReflection()
+}
+
+// ListServices 返回所有服务名，按名称排序
+func (r *Reflection) ListServices(_ int, reply *[]string) error {
+	var names []string
+	r.server.ServiceMap.Range(func(key, _ interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	*reply = names
+	return nil
+}
+
+// DescribeService 返回服务的所有方法及其参数和返回值类型，服务不存在时返回CodeNotFound
+func (r *Reflection) DescribeService(name string, reply *ServiceSchema) error {
+	v, ok := r.server.ServiceMap.Load(name)
+	if !ok {
+		return Errorf(CodeNotFound, "rpc reflection: can't find service %s", name)
+	}
+	*reply = *describeService(v.(*Service))
+	return nil
+}
+
+func describeService(s *Service) *ServiceSchema {
+	schema := &ServiceSchema{Name: s.name}
+	for name, m := range s.method {
+		schema.Methods = append(schema.Methods, MethodSchema{
+			Name:      name,
+			ArgType:   DescribeType(m.ArgType),
+			ReplyType: DescribeType(m.ReplyType),
+			NumCalls:  m.NumCalls(),
+		})
+	}
+	sort.Slice(schema.Methods, func(i, j int) bool {
+		return schema.Methods[i].Name < schema.Methods[j].Name
+	})
+	return schema
+}
+
+// DescribeType 递归地描述类型t，自引用的struct在第二次出现时只给出名称
+func DescribeType(t reflect.Type) *TypeSchema {
+	return describeType(t, make(map[reflect.Type]bool))
+}
+
+func describeType(t reflect.Type, visiting map[reflect.Type]bool) *TypeSchema {
+	schema := &TypeSchema{Name: t.String(), Kind: t.Kind().String()}
+	//递归的类型一定经过某个具名类型，例如type Tree map[string]Tree，只在具名类型上截断
+	if t.Name() != "" {
+		if visiting[t] {
+			schema.Recursive = true
+			return schema
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		schema.Elem = describeType(t.Elem(), visiting)
+	case reflect.Array:
+		schema.Len = t.Len()
+		schema.Elem = describeType(t.Elem(), visiting)
+	case reflect.Map:
+		schema.Key = describeType(t.Key(), visiting)
+		schema.Elem = describeType(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			schema.Fields = append(schema.Fields, FieldSchema{
+				Name: f.Name,
+				Type: describeType(f.Type, visiting),
+				Tag:  string(f.Tag),
+			})
+		}
+	}
+	return schema
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Node struct {
+	Value    int
+	Children []*Node
+	Labels   map[string]string
+	hidden   int
+}
+
+type Tree int
+
+// Forest 是引用自身的map类型，gob可以编码
+type Forest map[string]Forest
+
+func (t Tree) Walk(root *Node, reply *[4]int) error {
+	return nil
+}
+
+func TestReflection_ListAndDescribe(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	_ = server.Register(new(Tree))
+	server.RegisterReflection()
+	server.RegisterReflection()
+
+	v, _ := server.ServiceMap.Load(reflectionServiceName)
+	r := v.(*Service).rcvr.Interface().(*Reflection)
+
+	var names []string
+	_ = r.ListServices(0, &names)
+	_assert(strings.Join(names, ",") == "Foo,GeeRPC,Reflection,Tree", "unexpected services %v", names)
+
+	var schema ServiceSchema
+	err := r.DescribeService("Missing", &schema)
+	_assert(CodeOf(err) == CodeNotFound, "expect NotFound, got %v", err)
+
+	_ = r.DescribeService("Foo", &schema)
+	_assert(len(schema.Methods) == 1 && schema.Methods[0].Name == "Sum", "unexpected methods %+v", schema.Methods)
+	arg := schema.Methods[0].ArgType
+	_assert(arg.Kind == "struct" && len(arg.Fields) == 2 && arg.Fields[1].Name == "Num2" && arg.Fields[1].Type.Kind == "int",
+		"unexpected arg schema %+v", arg)
+	_assert(schema.Methods[0].ReplyType.Kind == "ptr" && schema.Methods[0].ReplyType.Elem.Kind == "int", "unexpected reply schema")
+}
+
+func TestDescribeType_Recursive(t *testing.T) {
+	schema := DescribeType(reflect.TypeOf(&Node{}))
+	node := schema.Elem
+	_assert(node.Kind == "struct" && len(node.Fields) == 3, "unexported fields should be skipped, got %+v", node.Fields)
+	child := node.Fields[1].Type.Elem.Elem
+	_assert(child.Name == node.Name && child.Recursive && child.Fields == nil, "recursive struct should not be expanded, got %+v", child)
+	labels := node.Fields[2].Type
+	_assert(labels.Kind == "map" && labels.Key.Kind == "string" && labels.Elem.Kind == "string", "unexpected map schema %+v", labels)
+	forest := DescribeType(reflect.TypeOf(Forest{}))
+	_assert(forest.Kind == "map" && !forest.Recursive && forest.Elem.Name == forest.Name && forest.Elem.Recursive && forest.Elem.Elem == nil,
+		"recursive map should not be expanded, got %+v", forest.Elem)
+	slice := DescribeType(reflect.TypeOf(&[]Forest{}))
+	_assert(slice.Elem.Elem.Elem.Recursive, "recursive map inside a slice should be cut off")
+	arr := DescribeType(reflect.TypeOf([4]int{}))
+	_assert(arr.Kind == "array" && arr.Len == 4, "unexpected array schema %+v", arr)
+
+	//schema本身要能通过gob传输
+	var buf bytes.Buffer
+	_assert(gob.NewEncoder(&buf).Encode(schema) == nil, "schema should be gob encodable")
+	var decoded TypeSchema
+	_assert(gob.NewDecoder(&buf).Decode(&decoded) == nil && reflect.DeepEqual(&decoded, schema), "schema should survive gob round trip")
+}
@@ -2,16 +2,20 @@ package server
 
 import (
 	"GeekRPC/codec"
+	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go/ast"
 	"io"
 	"log"
 	"net"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +26,9 @@ type Option struct {
 	CodecType codec.Type  // client may choose different Codec to encode body
 	ConnectTimeout time.Duration
 	HandleTimeout time.Duration
+	TLSConfig *tls.Config `json:"-"` //tls@协议使用的客户端配置，只在本地使用，不发送给服务端
+	Handshake bool `json:"handshake,omitempty"` //发送Option后进行认证握手，设置了Credentials时由客户端自动设置
+	Credentials Credentials `json:"-"` //客户端在认证握手中使用的认证信息
 }
 
 var DefaultOption = &Option{
@@ -33,11 +40,30 @@ var DefaultOption = &Option{
 // Server represents an RPC Server.
 type Server struct {
 	ServiceMap sync.Map //is like a map[interface{}]interface{}
+	mu sync.Mutex //串行化注册，RegisterFunc会替换已经注册的service
+	auth Authenticator //为nil时不认证连接
+	authz atomic.Value //authorizerHolder，每个请求都要读取，不加锁
 }
 
 //实例化一个service，并检查之前是否已经实例化过
 func (server *Server) Register(rcvr interface{}) error {
 	s := newService(rcvr)
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _,dup := server.ServiceMap.LoadOrStore(s.name,s);dup{
+		return errors.New("rpc: Service already defined: " + s.name)
+	}
+	return nil
+}
+
+// RegisterName 与Register相同，但是使用name而不是rcvr的类型名作为服务名
+func (server *Server) RegisterName(name string,rcvr interface{}) error {
+	if !ast.IsExported(name) {
+		return errors.New("rpc: Service name is not exported: " + name)
+	}
+	s := newNamedService(name,rcvr)
+	server.mu.Lock()
+	defer server.mu.Unlock()
 	if _,dup := server.ServiceMap.LoadOrStore(s.name,s);dup{
 		return errors.New("rpc: Service already defined: " + s.name)
 	}
@@ -52,7 +78,7 @@ func Register(rcvr interface{}) error {
 func (server *Server) findService(servicMethod string) (svc *Service,mtype *MethodType,err error)  {
 	dot := strings.LastIndex(servicMethod,".")
 	if dot < 0 {
-		err = errors.New("rpc server: Service/method request ill-formed:" + servicMethod)
+		err = Errorf(CodeNotFound,"rpc server: Service/method request ill-formed:%s",servicMethod)
 		return
 	}
 
@@ -60,21 +86,23 @@ func (server *Server) findService(servicMethod string) (svc *Service,mtype *Meth
 
 	svci,ok := server.ServiceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc server: can't find Service"+serviceName)
+		err = Errorf(CodeNotFound,"rpc server: can't find Service %s",serviceName)
 		return
 	}
 
 	svc = svci.(*Service)
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc server: can't find method "+methodName)
+		err = Errorf(CodeNotFound,"rpc server: can't find method %s",methodName)
 	}
 	return
 }
 
 // NewServer returns a new Server.
 func NewServer() *Server {
-	return &Server{}
+	server := &Server{}
+	_ = server.RegisterName(builtinServiceName,builtin{})
+	return server
 }
 
 // DefaultServer is the default instance of *Server.
@@ -111,6 +139,7 @@ func (server *Server) readRequest(cc codec.Codec)(*request,error) {
 
 	req.svc,req.mtype,err = server.findService(h.ServiceMethod)
 	if err != nil {
+		_ = cc.ReadBody(nil) //丢弃body，避免后续请求错位
 		return req,err
 	}
 	req.argv = req.mtype.newArgv()
@@ -122,7 +151,7 @@ func (server *Server) readRequest(cc codec.Codec)(*request,error) {
 	}
 	if err = cc.ReadBody(argvi);err!= nil { //argvi是一个指针
 		log.Println("rpc server: read body err: ",err)
-		return req,err
+		return req,Errorf(CodeInvalidArgument,"rpc server: read body err: %v",err)
 	}
 
 	return req,nil
@@ -132,19 +161,26 @@ func (server *Server) readRequest(cc codec.Codec)(*request,error) {
 func (server *Server) sendResponse(cc codec.Codec,h *codec.Header,body interface{},sending *sync.Mutex){
 	sending.Lock()
 	defer sending.Unlock()
+	//元数据只随请求发送，响应中不原样带回
+	h.Metadata = nil
 	if err := cc.Write(h,body); err != nil {
 		log.Println("rpc server: write response error: ",err)
 	}
 }
 
 //把req的信息加工添加一些内容后形成reply写进cc中
-func (server *Server) handleRequest(cc codec.Codec,req *request,sending *sync.Mutex,wg *sync.WaitGroup,timeout time.Duration){
+func (server *Server) handleRequest(base context.Context,cc codec.Codec,req *request,sending *sync.Mutex,wg *sync.WaitGroup,timeout time.Duration){
 	defer wg.Done()
 	called := make(chan struct{})
 	sent := make(chan struct{})
-	ctx,cancel := context.WithCancel(context.Background())
+	//ctx在超时后取消，并带有请求头中的元数据和连接的对端信息
+	ctx,cancel := context.WithCancel(withMetadata(base,req.h.Metadata))
+	defer cancel()
 	go func(ctx context.Context) {
-		err := req.svc.call(req.mtype,req.argv,req.replyv)
+		err := server.authorize(ctx,req.svc,req.h.ServiceMethod)
+		if err == nil {
+			err = req.svc.call(ctx,req.mtype,req.argv,req.replyv)
+		}
 
 		select {
 		case called <- struct{}{}: //阻塞直到called被接收
@@ -153,6 +189,7 @@ func (server *Server) handleRequest(cc codec.Codec,req *request,sending *sync.Mu
 		}
 		if err != nil {
 			req.h.Error = err.Error()
+			req.h.Code = int(CodeOf(err))
 			server.sendResponse(cc,req.h,invalidRequest,sending)
 			sent <- struct{}{}
 			return
@@ -175,23 +212,32 @@ func (server *Server) handleRequest(cc codec.Codec,req *request,sending *sync.Mu
 	select {
 	case <- time.After(timeout):
 		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s",timeout)
+		req.h.Code = int(CodeDeadlineExceeded)
 		server.sendResponse(cc,req.h,invalidRequest,sending)
 		cancel()
 	case <- called:
 		<-sent
+	case <- base.Done():
+		//连接已经断开，响应发不出去了
 	}
 
 }
 
 var invalidRequest = struct{}{}
 
+// handleTimeout 是服务端处理一个请求的超时时间，测试时可以修改
+var handleTimeout = time.Second*10
+
 //读取cc中的内容，
 //
 //加工添加一些额外信息进去后再写进cc中
-func (server *Server) serveCodec(cc codec.Codec) {
+func (server *Server) serveCodec(ctx context.Context,cc codec.Codec) {
 	// Todo
 	sending := new(sync.Mutex)
 	wg := new(sync.WaitGroup)
+	//客户端断开后取消还在处理的请求，例如挂起的Health.Watch
+	ctx,cancel := context.WithCancel(ctx)
+	defer cancel()
 	for {
 		req,err := server.readRequest(cc)
 		if err != nil {
@@ -199,12 +245,14 @@ func (server *Server) serveCodec(cc codec.Codec) {
 				break
 			}
 			req.h.Error = err.Error()
+			req.h.Code = int(CodeOf(err))
 			server.sendResponse(cc,req.h,invalidRequest,sending)
 			continue
 		}
 		wg.Add(1)
-		go server.handleRequest(cc,req,sending,wg,time.Second*10)
+		go server.handleRequest(ctx,cc,req,sending,wg,handleTimeout)
 	}
+	cancel()
 	wg.Wait()
 	_ = cc.Close()
 }
@@ -222,26 +270,66 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 		_ = conn.Close()
 	}()
 
+	ctx := context.Background()
+	if c,ok := conn.(net.Conn); ok {
+		//TLS连接需要先完成握手才能拿到客户端的证书
+		peer,err := newPeer(c)
+		if err != nil {
+			log.Println("rpc server: tls handshake error: ",err)
+			return
+		}
+		ctx = context.WithValue(ctx,peerKey{},peer)
+	}
+
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt);err!=nil{
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt);err!=nil{
 		log.Println("rpc server: options error: ",err)
 		return
 	}
-
 	if opt.MagicNumber != MagicNumber {
 		log.Printf("rpc server: invalid magic number %x ",opt.MagicNumber)
 		return
 	}
-
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		log.Printf("rpc server: invalid codec Type %s ",opt.CodecType)
 		return
 	}
 
-	server.serveCodec(f(conn))
+	ctx,authErr := server.authenticate(ctx,conn,dec,&opt)
+	if authErr != nil && opt.Handshake {
+		//认证结果已经在握手中告诉客户端了
+		log.Println("rpc server: authentication failed: ",authErr)
+		return
+	}
+
+	//json.Decoder可能已经多读了option之后的数据，需要先把这部分交给codec；
+	//另外json.Encoder会在option后面追加一个换行符，要跳过它，否则会被codec当作body的一部分
+	br := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b,err := br.Peek(1); err == nil && b[0] == '\n' {
+		_,_ = br.Discard(1)
+	}
+	conn = &bufferedConn{r: br, ReadWriteCloser: conn}
+
+	if authErr != nil {
+		//客户端不支持握手，只能在每个请求的响应中返回错误
+		server.reject(f(conn),authErr)
+		return
+	}
+	server.serveCodec(ctx,f(conn))
+
 
+}
+
+// bufferedConn 先读取r中缓存的数据，写和关闭仍然走原来的conn
+type bufferedConn struct {
+	r io.Reader
+	io.ReadWriteCloser
+}
 
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
 }
 
 // Accept accepts connections on the listener and serves requests
@@ -47,3 +47,19 @@ func TestNewServer(t *testing.T) {
 		log.Println("reply:",body)
 	}
 }
+
+func TestServer_ResponseWithoutMetadata(t *testing.T) {
+	server := NewServer()
+	_ = server.Register(new(Foo))
+	md := map[string]string{"token": "secret"}
+
+	var reply int
+	h := rawCall(t,server,&codec.Header{ServiceMethod: "Foo.Sum",Seq: 1,Metadata: md},Args{Num1: 1,Num2: 2},&reply)
+	_assert(h.Error == "" && reply == 3,"expect 3, got %d, %s",reply,h.Error)
+	_assert(h.Metadata == nil,"expect no metadata in response, got %v",h.Metadata)
+
+	//找不到方法时的错误响应也不能带回元数据
+	h = rawCall(t,server,&codec.Header{ServiceMethod: "Foo.Missing",Seq: 1,Metadata: md},Args{},nil)
+	_assert(h.Error != "","expect error for unknown method")
+	_assert(h.Metadata == nil,"expect no metadata in error response, got %v",h.Metadata)
+}
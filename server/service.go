@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"go/ast"
 	"log"
 	"reflect"
@@ -12,8 +13,12 @@ type MethodType struct {
 	ArgType reflect.Type
 	ReplyType reflect.Type
 	numCalls uint64
+	fn func(ctx context.Context,argv,replyv interface{}) error //通过RegisterFunc注册的函数，为nil时反射调用method
+	withCtx bool //method的第一个参数是context.Context
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func (m *MethodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
@@ -50,13 +55,19 @@ type Service struct {
 
 // 创建service实例
 func newService(rcvr interface{}) *Service {
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name() //如果rcvr是指针，Type().Name()为空
+	if !ast.IsExported(name) {
+		log.Fatalf("rpc server: %s is not a valid Service name",name)
+	}
+	return newNamedService(name,rcvr)
+}
+
+// 以name作为服务名创建service实例，rcvr的类型可以不导出
+func newNamedService(name string,rcvr interface{}) *Service {
 	s := new(Service)
 	s.rcvr = reflect.ValueOf(rcvr)
-	s.name = reflect.Indirect(s.rcvr).Type().Name() //如果rcvr是指针，s.rcvr.Type().Name()为空
+	s.name = name
 	s.typ = reflect.TypeOf(rcvr)
-	if !ast.IsExported(s.name) {
-		log.Fatalf("rpc server: %s is not a valid Service name",s.name)
-	}
 	s.registerMethods()
 	return s
 }
@@ -67,14 +78,20 @@ func (s *Service) registerMethods() {
 	for i:=0;i<s.typ.NumMethod();i++{
 		method := s.typ.Method(i)
 		mType := method.Type
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		//方法可以在参数前面多接收一个context.Context，其中带有请求的元数据和对端信息
+		numIn := mType.NumIn()
+		if numIn != 3 && numIn != 4 || mType.NumOut() != 1 {
 			continue
 		}
 		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
 			continue
 		}
+		withCtx := numIn == 4
+		if withCtx && mType.In(1) != contextType {
+			continue
+		}
 
-		argType,replyType := mType.In(1),mType.In(2)
+		argType,replyType := mType.In(numIn-2),mType.In(numIn-1)
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			continue
 		}
@@ -83,6 +100,7 @@ func (s *Service) registerMethods() {
 			method: method,
 			ArgType: argType,
 			ReplyType: replyType,
+			withCtx: withCtx,
 		}
 		log.Printf("rpc server: register %s.%s\n",s.name,method.Name)
 	}
@@ -92,10 +110,17 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath()== ""
 }
 
-func (s *Service) call(m *MethodType, argv, replyv reflect.Value) error {
+func (s *Service) call(ctx context.Context,m *MethodType, argv, replyv reflect.Value) error {
 	atomic.AddUint64(&m.numCalls,1)
+	if m.fn != nil {
+		return m.fn(ctx,argv.Interface(),replyv.Interface())
+	}
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.rcvr,argv,replyv})
+	in := []reflect.Value{s.rcvr,argv,replyv}
+	if m.withCtx {
+		in = []reflect.Value{s.rcvr,reflect.ValueOf(ctx),argv,replyv}
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -42,6 +43,26 @@ func TestNewService(t *testing.T) {
 	_assert(mType != nil,"wrong Method,Sum shouldn't nil")
 }
 
+func TestServer_RegisterName(t *testing.T) {
+	server := NewServer()
+	_assert(server.RegisterName("Calc",new(Foo)) == nil,"RegisterName should succeed")
+	_,mtype,err := server.findService("Calc.Sum")
+	_assert(err == nil && mtype != nil,"Calc.Sum should be registered, got %v",err)
+	_assert(server.RegisterName("Calc",new(Foo)) != nil,"duplicate name should fail")
+	_assert(server.RegisterName("calc",new(Foo)) != nil,"unexported name should fail")
+
+	svc,mtype,err := server.findService(PingMethod)
+	_assert(err == nil,"built-in %s should be registered, got %v",PingMethod,err)
+	var ok bool
+	_assert(svc.call(context.Background(),mtype,reflect.ValueOf(0),reflect.ValueOf(&ok)) == nil && ok,"ping should reply true")
+
+	//名字中的%不能被当作格式化动词
+	_,_,err = server.findService("Calc%d.Sum")
+	_assert(err != nil && strings.Contains(err.Error(),"Calc%d"),"expect service name in error, got %v",err)
+	_,_,err = server.findService("Calc.Sum%s")
+	_assert(err != nil && strings.Contains(err.Error(),"Sum%s"),"expect method name in error, got %v",err)
+}
+
 func TestOther(t *testing.T) {
 	arg := Args{
 		Num1: 1,
@@ -57,6 +78,7 @@ func TestSelect(t *testing.T) {
 	A := make(chan struct{})
 	B := make(chan struct{})
 	ctx,cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func(ctx context.Context) {
 		defer func() {
 			fmt.Println("gorutine exit")
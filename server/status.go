@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Code 是RPC调用的错误码，服务端通过Header.Code返回给客户端
+type Code int
+
+const (
+	CodeOK Code = iota
+	CodeUnknown
+	CodeCanceled
+	CodeDeadlineExceeded
+	CodeNotFound
+	CodeInvalidArgument
+	CodeUnavailable //连接失败、连接断开等，可以换一台服务重试
+	CodeResourceExhausted
+	CodeUnauthenticated
+	CodePermissionDenied
+	CodeInternal
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                "OK",
+	CodeUnknown:           "Unknown",
+	CodeCanceled:          "Canceled",
+	CodeDeadlineExceeded:  "DeadlineExceeded",
+	CodeNotFound:          "NotFound",
+	CodeInvalidArgument:   "InvalidArgument",
+	CodeUnavailable:       "Unavailable",
+	CodeResourceExhausted: "ResourceExhausted",
+	CodeUnauthenticated:   "Unauthenticated",
+	CodePermissionDenied:  "PermissionDenied",
+	CodeInternal:          "Internal",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", int(c))
+}
+
+// Error 是带错误码的错误，服务方法返回*Error时错误码会原样传给客户端
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func NewError(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+func Errorf(code Code, format string, a ...interface{}) error {
+	return NewError(code, fmt.Sprintf(format, a...))
+}
+
+// CodeOf 返回err对应的错误码，没有显式错误码的网络错误都当作CodeUnavailable
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &netErr):
+		return CodeUnavailable
+	}
+	return CodeUnknown
+}
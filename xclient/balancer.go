@@ -0,0 +1,122 @@
+package xclient
+
+import (
+	"GeekRPC/client"
+	"GeekRPC/server"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ewmaDecay 是EWMA延迟的衰减时间，越久之前的样本权重越低
+const ewmaDecay = time.Second * 10
+
+// addrLoad 记录一个服务地址的EWMA延迟
+type addrLoad struct {
+	mu    sync.Mutex
+	ewma  float64 //纳秒
+	stamp time.Time
+}
+
+func (l *addrLoad) observe(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.stamp.IsZero() {
+		l.ewma = float64(rtt)
+	} else {
+		w := math.Exp(-float64(now.Sub(l.stamp)) / float64(ewmaDecay))
+		l.ewma = l.ewma*w + float64(rtt)*(1-w)
+	}
+	l.stamp = now
+}
+
+// failurePenalty 是连接失败、超时等调用计入EWMA的最小延迟。
+// 只记录成功的调用时，总是失败的服务延迟一直是0，会被当作最快的服务拿走所有流量
+const failurePenalty = time.Second
+
+// 记录rpcAddr上一次调用的延迟：成功或者服务端返回了业务错误时按实际耗时，
+// 服务不可用、超时时至少按failurePenalty，被取消的调用不记录
+func (xc *XClient) observeResult(rpcAddr string, rtt time.Duration, err error) {
+	switch server.CodeOf(err) {
+	case server.CodeCanceled:
+		return
+	case server.CodeUnavailable, server.CodeDeadlineExceeded:
+		if rtt < failurePenalty {
+			rtt = failurePenalty
+		}
+	}
+	xc.load(rpcAddr).observe(rtt)
+}
+
+func (l *addrLoad) latency() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ewma
+}
+
+// 是否由XClient根据负载选择服务，而不是交给Discovery.Get
+func (mode SelectMode) loadAware() bool {
+	return mode == LeastPendingSelect || mode == LeastLatencySelect
+}
+
+func (xc *XClient) load(rpcAddr string) *addrLoad {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	l, ok := xc.loads[rpcAddr]
+	if !ok {
+		l = &addrLoad{}
+		xc.loads[rpcAddr] = l
+	}
+	return l
+}
+
+func (xc *XClient) pending(rpcAddr string) int {
+	xc.mu.Lock()
+	var pool *client.Pool
+	if entry := xc.clients[rpcAddr]; entry != nil {
+		pool = entry.connPool()
+	}
+	xc.mu.Unlock()
+	if pool == nil {
+		return 0
+	}
+	return pool.NumPending()
+}
+
+// a的负载是否比b低。没有延迟样本的服务延迟按0处理，这样新加入的服务可以先拿到流量
+func (xc *XClient) lighter(a, b string) bool {
+	pa, pb := xc.pending(a), xc.pending(b)
+	la, lb := xc.load(a).latency(), xc.load(b).latency()
+	if xc.mode == LeastLatencySelect {
+		if la != lb {
+			return la < lb
+		}
+		return pa < pb
+	}
+	if pa != pb {
+		return pa < pb
+	}
+	return la < lb
+}
+
+// 两次随机选择（power of two choices）：随机取两个服务，选负载低的一个；
+// 选中的服务被熔断时从候选中去掉后重新选择
+func (xc *XClient) pickByLoad(servers []string) (string, bool) {
+	candidates := append([]string(nil), servers...)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	for len(candidates) > 0 {
+		i := 0
+		if len(candidates) > 1 && xc.lighter(candidates[1], candidates[0]) {
+			i = 1
+		}
+		if xc.allow(candidates[i]) {
+			return candidates[i], true
+		}
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	return "", false
+}
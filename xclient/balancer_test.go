@@ -0,0 +1,81 @@
+package xclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestXClient_LeastLatencySelect(t *testing.T) {
+	slow, slowAddr := startLaggerServer(t, time.Millisecond*50)
+	fast, fastAddr := startLaggerServer(t, 0)
+	xc := NewXClient(NewMultiServerDiscovery([]string{slowAddr, fastAddr}), LeastLatencySelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	for i := 0; i < 10; i++ {
+		var reply int
+		if err := xc.Call(context.Background(), "Lagger.Do", &Args{Num1: i}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, f := atomic.LoadInt32(&slow.calls), atomic.LoadInt32(&fast.calls); s > 1 || f < 9 {
+		t.Fatalf("expect calls to go to the fast server, got slow %d fast %d", s, f)
+	}
+}
+
+func TestXClient_LeastLatencySelectAvoidsFailingServer(t *testing.T) {
+	bad, badAddr := startFlakyServer(t, true)
+	good, goodAddr := startFlakyServer(t, false)
+	xc := NewXClient(NewMultiServerDiscovery([]string{badAddr, goodAddr}), LeastLatencySelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	for i := 0; i < 10; i++ {
+		var reply int
+		_ = xc.Call(context.Background(), "Flaky.Do", &Args{Num1: i}, &reply)
+	}
+	//失败的调用按failurePenalty计入延迟，不会因为没有延迟样本而一直被选中
+	if b, g := atomic.LoadInt32(&bad.calls), atomic.LoadInt32(&good.calls); b > 1 || g < 9 {
+		t.Fatalf("expect calls to avoid the failing server, got bad %d good %d", b, g)
+	}
+}
+
+func TestXClient_LeastPendingSelect(t *testing.T) {
+	slow, slowAddr := startLaggerServer(t, time.Millisecond*300)
+	fast, fastAddr := startLaggerServer(t, 0)
+	xc := NewXClient(NewMultiServerDiscovery([]string{slowAddr, fastAddr}), LeastPendingSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply int
+			if err := xc.Call(context.Background(), "Lagger.Do", &Args{Num1: i}, &reply); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		time.Sleep(time.Millisecond * 10)
+	}
+	wg.Wait()
+	//慢的服务上有调用没有返回时，后面的调用都应该发给快的服务
+	if s, f := atomic.LoadInt32(&slow.calls), atomic.LoadInt32(&fast.calls); s > 2 || f < 8 {
+		t.Fatalf("expect calls to go to the idle server, got slow %d fast %d", s, f)
+	}
+}
+
+func TestAddrLoad_Observe(t *testing.T) {
+	l := &addrLoad{}
+	l.observe(time.Millisecond * 100)
+	if l.latency() != float64(time.Millisecond*100) {
+		t.Fatalf("unexpected first sample %f", l.latency())
+	}
+	l.stamp = l.stamp.Add(-ewmaDecay)
+	l.observe(0)
+	//经过一个衰减周期后旧样本的权重为1/e
+	if got := l.latency() / float64(time.Millisecond*100); got < 0.36 || got > 0.37 {
+		t.Fatalf("unexpected decayed latency ratio %f", got)
+	}
+}
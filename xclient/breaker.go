@@ -0,0 +1,267 @@
+package xclient
+
+import (
+	"GeekRPC/server"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota //正常调用
+	BreakerOpen                         //熔断，跳过该服务
+	BreakerHalfOpen                     //熔断超时后放少量探测请求过去
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerPolicy 描述每个服务地址上熔断器的打开和恢复条件
+type BreakerPolicy struct {
+	ConsecutiveFailures int           //连续失败多少次后熔断，0表示不按连续失败熔断
+	ErrorRate           float64       //统计窗口内错误率达到多少后熔断，0表示不按错误率熔断
+	MinRequests         int           //统计窗口内至少有多少个请求才计算错误率
+	Window              time.Duration //错误率的统计窗口
+	OpenTimeout         time.Duration //熔断多久后进入半开状态
+	HalfOpenProbes      int           //半开状态下允许同时进行的探测请求数，全部成功后恢复
+	FailureCodes        []server.Code //算作失败的错误码，为空时为CodeUnavailable和CodeDeadlineExceeded
+	//状态变化时的回调，可以用来上报监控
+	OnStateChange func(rpcAddr string, from, to BreakerState)
+}
+
+var DefaultBreakerPolicy = &BreakerPolicy{
+	ConsecutiveFailures: 5,
+	ErrorRate:           0.5,
+	MinRequests:         20,
+	Window:              time.Second * 10,
+	OpenTimeout:         time.Second * 5,
+	HalfOpenProbes:      1,
+}
+
+func (p *BreakerPolicy) halfOpenProbes() int {
+	if p.HalfOpenProbes <= 0 {
+		return 1
+	}
+	return p.HalfOpenProbes
+}
+
+func (p *BreakerPolicy) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := server.CodeOf(err)
+	if len(p.FailureCodes) == 0 {
+		return code == server.CodeUnavailable || code == server.CodeDeadlineExceeded
+	}
+	for _, c := range p.FailureCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+type circuitBreaker struct {
+	rpcAddr string
+	p       *BreakerPolicy
+
+	mu          sync.Mutex
+	state       BreakerState
+	consecutive int //连续失败次数
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int //半开状态下正在进行的探测请求数，探测结束后归还
+	probeOK     int //半开状态下成功的探测请求数
+}
+
+func newCircuitBreaker(rpcAddr string, p *BreakerPolicy) *circuitBreaker {
+	return &circuitBreaker{
+		rpcAddr:     rpcAddr,
+		p:           p,
+		windowStart: time.Now(),
+	}
+}
+
+// 切换状态，调用方持有b.mu；返回值用于在释放锁后通知回调
+func (b *circuitBreaker) setState(state BreakerState) func() {
+	from := b.state
+	if from == state {
+		return nil
+	}
+	b.state = state
+	b.consecutive, b.requests, b.failures = 0, 0, 0
+	b.windowStart = time.Now()
+	b.probes, b.probeOK = 0, 0
+	if state == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+	if b.p.OnStateChange == nil {
+		return nil
+	}
+	return func() { b.p.OnStateChange(b.rpcAddr, from, state) }
+}
+
+// allow 判断是否可以使用该服务，半开状态下会占用一个探测名额
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	var notify func()
+	defer func() {
+		b.mu.Unlock()
+		if notify != nil {
+			notify()
+		}
+	}()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.p.OpenTimeout {
+			return false
+		}
+		notify = b.setState(BreakerHalfOpen)
+	}
+
+	if b.probes >= b.p.halfOpenProbes() {
+		return false
+	}
+	b.probes++
+	return true
+}
+
+func (b *circuitBreaker) onResult(err error) {
+	failed := b.p.isFailure(err)
+	//被取消的调用（对冲中输掉的请求、调用方放弃的请求）不能说明服务的好坏，不计入统计
+	canceled := server.CodeOf(err) == server.CodeCanceled
+
+	b.mu.Lock()
+	var notify func()
+	defer func() {
+		b.mu.Unlock()
+		if notify != nil {
+			notify()
+		}
+	}()
+
+	switch b.state {
+	case BreakerOpen:
+		return
+	case BreakerHalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		if canceled {
+			return
+		}
+		if failed {
+			notify = b.setState(BreakerOpen)
+			return
+		}
+		b.probeOK++
+		if b.probeOK >= b.p.halfOpenProbes() {
+			notify = b.setState(BreakerClosed)
+		}
+		return
+	}
+	if canceled {
+		return
+	}
+
+	if b.p.Window > 0 && time.Since(b.windowStart) > b.p.Window {
+		b.windowStart = time.Now()
+		b.requests, b.failures = 0, 0
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+
+	if b.p.ConsecutiveFailures > 0 && b.consecutive >= b.p.ConsecutiveFailures {
+		notify = b.setState(BreakerOpen)
+		return
+	}
+	if b.p.ErrorRate > 0 && b.requests >= b.p.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.p.ErrorRate {
+		notify = b.setState(BreakerOpen)
+	}
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.p.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// SetBreakerPolicy 为每个服务地址启用熔断器，nil表示关闭熔断
+func (xc *XClient) SetBreakerPolicy(p *BreakerPolicy) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.breakerPolicy = p
+	xc.breakers = make(map[string]*circuitBreaker)
+}
+
+func (xc *XClient) breaker(rpcAddr string) *circuitBreaker {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.breakerPolicy == nil {
+		return nil
+	}
+	b, ok := xc.breakers[rpcAddr]
+	if !ok {
+		b = newCircuitBreaker(rpcAddr, xc.breakerPolicy)
+		xc.breakers[rpcAddr] = b
+	}
+	return b
+}
+
+// 熔断器是否允许使用rpcAddr
+func (xc *XClient) allow(rpcAddr string) bool {
+	if !xc.healthy(rpcAddr) {
+		return false
+	}
+	if b := xc.breaker(rpcAddr); b != nil {
+		return b.allow()
+	}
+	return true
+}
+
+func (xc *XClient) recordResult(rpcAddr string, err error) {
+	if b := xc.breaker(rpcAddr); b != nil {
+		b.onResult(err)
+	}
+}
+
+// BreakerStates 返回各个服务地址当前的熔断状态
+func (xc *XClient) BreakerStates() map[string]BreakerState {
+	xc.mu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(xc.breakers))
+	for _, b := range xc.breakers {
+		breakers = append(breakers, b)
+	}
+	xc.mu.Unlock()
+
+	states := make(map[string]BreakerState, len(breakers))
+	for _, b := range breakers {
+		states[b.rpcAddr] = b.State()
+	}
+	return states
+}
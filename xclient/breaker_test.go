@@ -0,0 +1,160 @@
+package xclient
+
+import (
+	server2 "GeekRPC/server"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var changes []BreakerState
+	b := newCircuitBreaker("tcp@a", &BreakerPolicy{
+		ConsecutiveFailures: 2,
+		OpenTimeout:         time.Millisecond * 50,
+		HalfOpenProbes:      1,
+		OnStateChange: func(rpcAddr string, from, to BreakerState) {
+			changes = append(changes, to)
+		},
+	})
+	unavailable := server2.NewError(server2.CodeUnavailable, "unavailable")
+
+	b.onResult(unavailable)
+	b.onResult(errors.New("application error")) //业务错误不算失败
+	b.onResult(unavailable)
+	if !b.allow() {
+		t.Fatal("breaker should be closed")
+	}
+	b.onResult(unavailable)
+	if b.allow() || b.State() != BreakerOpen {
+		t.Fatalf("breaker should be open, got %s", b.State())
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if !b.allow() {
+		t.Fatal("breaker should allow a probe")
+	}
+	if b.allow() {
+		t.Fatal("breaker should allow only one probe")
+	}
+	b.onResult(unavailable)
+	if b.State() != BreakerOpen {
+		t.Fatalf("failed probe should reopen breaker, got %s", b.State())
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if !b.allow() {
+		t.Fatal("breaker should allow a probe")
+	}
+	b.onResult(nil)
+	if b.State() != BreakerClosed {
+		t.Fatalf("breaker should be closed, got %s", b.State())
+	}
+
+	expect := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(changes) != len(expect) {
+		t.Fatalf("expect state changes %v, got %v", expect, changes)
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Fatalf("expect state changes %v, got %v", expect, changes)
+		}
+	}
+}
+
+func TestCircuitBreaker_CanceledProbe(t *testing.T) {
+	b := newCircuitBreaker("tcp@a", &BreakerPolicy{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Millisecond * 20,
+		HalfOpenProbes:      2,
+	})
+	unavailable := server2.NewError(server2.CodeUnavailable, "unavailable")
+	canceled := fmt.Errorf("rpc client: call failed: %w", context.Canceled)
+
+	//关闭状态下被取消的调用不会清零连续失败次数
+	b.onResult(canceled)
+	b.onResult(unavailable)
+	if b.State() != BreakerOpen {
+		t.Fatalf("breaker should be open, got %s", b.State())
+	}
+	time.Sleep(time.Millisecond * 30)
+	if !b.allow() || !b.allow() || b.allow() {
+		t.Fatal("breaker should allow exactly two concurrent probes")
+	}
+	//被取消的探测归还名额，不算成功
+	b.onResult(canceled)
+	b.onResult(canceled)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("canceled probes should keep breaker half-open, got %s", b.State())
+	}
+	//名额是并发上限，不是总数
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatal("breaker should allow a probe after the slot is released")
+		}
+		b.onResult(nil)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("breaker should be closed after two successful probes, got %s", b.State())
+	}
+}
+
+func TestCircuitBreaker_ErrorRate(t *testing.T) {
+	b := newCircuitBreaker("tcp@a", &BreakerPolicy{
+		ErrorRate:   0.5,
+		MinRequests: 4,
+		Window:      time.Minute,
+		OpenTimeout: time.Minute,
+	})
+	unavailable := server2.NewError(server2.CodeUnavailable, "unavailable")
+	b.onResult(nil)
+	b.onResult(unavailable)
+	b.onResult(nil)
+	if b.State() != BreakerClosed {
+		t.Fatal("breaker should stay closed before MinRequests")
+	}
+	b.onResult(unavailable)
+	if b.State() != BreakerOpen {
+		t.Fatalf("breaker should be open, got %s", b.State())
+	}
+}
+
+func TestXClient_Breaker(t *testing.T) {
+	_, good := startFlakyServer(t, false)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	dead := "tcp@" + l.Addr().String()
+	_ = l.Close()
+
+	xc := NewXClient(NewMultiServerDiscovery([]string{dead, good}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBreakerPolicy(&BreakerPolicy{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Minute,
+	})
+
+	var reply int
+	failed := 0
+	for i := 0; i < 6; i++ {
+		if err := xc.Call(context.Background(), "Flaky.Do", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("expect only the first call to the dead server to fail, got %d failures", failed)
+	}
+	states := xc.BreakerStates()
+	if states[dead] != BreakerOpen || states[good] != BreakerClosed {
+		t.Fatalf("unexpected breaker states %v", states)
+	}
+
+	xc2 := NewXClient(NewMultiServerDiscovery([]string{dead}), RandomSelect, nil)
+	defer func() { _ = xc2.Close() }()
+	xc2.SetBreakerPolicy(&BreakerPolicy{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+	_ = xc2.Call(context.Background(), "Flaky.Do", &Args{}, &reply)
+	if err := xc2.Call(context.Background(), "Flaky.Do", &Args{}, &reply); err != ErrAllBreakersOpen {
+		t.Fatalf("expect ErrAllBreakersOpen, got %v", err)
+	}
+}
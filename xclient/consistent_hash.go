@@ -0,0 +1,156 @@
+package xclient
+
+import (
+	"context"
+	"hash/crc32"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HashKeyer 可以由调用参数实现，ConsistentHashSelect模式下用HashKey()的返回值选择服务
+type HashKeyer interface {
+	HashKey() string
+}
+
+type hashKeyCtx struct{}
+
+// WithHashKey 返回携带一致性哈希key的ctx，优先级高于参数实现的HashKeyer
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtx{}, key)
+}
+
+func hashKey(ctx context.Context, args interface{}) (string, bool) {
+	if key, ok := ctx.Value(hashKeyCtx{}).(string); ok {
+		return key, true
+	}
+	if k, ok := args.(HashKeyer); ok {
+		return k.HashKey(), true
+	}
+	return "", false
+}
+
+type ConsistentHashOption struct {
+	Replicas int //每个服务在哈希环上的虚拟节点数
+	// 有界负载系数，大于1时每个服务正在进行的调用数不超过平均值的LoadFactor倍，
+	// 超过时顺时针顺延到下一个服务；0表示不限制
+	LoadFactor float64
+}
+
+var DefaultConsistentHashOption = &ConsistentHashOption{
+	Replicas: 100,
+}
+
+// SetConsistentHashOption 设置ConsistentHashSelect模式下哈希环的参数
+func (xc *XClient) SetConsistentHashOption(opt *ConsistentHashOption) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.hashOpt = opt
+	xc.ring = nil
+}
+
+// hashRing 是带虚拟节点的一致性哈希环
+type hashRing struct {
+	members string   //排序后的服务列表，用于判断服务列表是否变化
+	keys    []uint32 //排序后的虚拟节点哈希值
+	nodes   map[uint32]string
+}
+
+func newHashRing(servers []string, replicas int) *hashRing {
+	if replicas <= 0 {
+		replicas = 1
+	}
+	sorted := append([]string(nil), servers...)
+	sort.Strings(sorted)
+	r := &hashRing{
+		members: strings.Join(sorted, ","),
+		nodes:   make(map[uint32]string, len(servers)*replicas),
+	}
+	//虚拟节点只和服务自身的地址有关，增删服务时其他服务的虚拟节点不变，只有少量key需要迁移
+	for _, s := range sorted {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + s))
+			if _, dup := r.nodes[h]; dup {
+				continue
+			}
+			r.keys = append(r.keys, h)
+			r.nodes[h] = s
+		}
+	}
+	sort.Slice(r.keys, func(i, j int) bool { return r.keys[i] < r.keys[j] })
+	return r
+}
+
+// get 从key所在位置开始顺时针查找第一个不被skip的服务
+func (r *hashRing) get(key string, skip func(addr string) bool) (string, bool) {
+	if len(r.keys) == 0 {
+		return "", false
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= h })
+	visited := make(map[string]bool)
+	for i := 0; i < len(r.keys); i++ {
+		addr := r.nodes[r.keys[(start+i)%len(r.keys)]]
+		if visited[addr] {
+			continue
+		}
+		visited[addr] = true
+		if skip == nil || !skip(addr) {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+// 返回与servers一致的哈希环，服务列表变化时重新构建
+func (xc *XClient) hashRing(servers []string) *hashRing {
+	sorted := append([]string(nil), servers...)
+	sort.Strings(sorted)
+	members := strings.Join(sorted, ",")
+
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.ring == nil || xc.ring.members != members {
+		opt := xc.hashOpt
+		if opt == nil {
+			opt = DefaultConsistentHashOption
+		}
+		xc.ring = newHashRing(servers, opt.Replicas)
+	}
+	return xc.ring
+}
+
+// 按一致性哈希选择服务。没有key时退化为负载感知的随机选择
+func (xc *XClient) pickByHash(ctx context.Context, args interface{}, servers []string, exclude map[string]bool) (string, error) {
+	key, ok := hashKey(ctx, args)
+	if !ok {
+		return xc.pickFromAll(servers, exclude)
+	}
+
+	xc.mu.Lock()
+	opt := xc.hashOpt
+	xc.mu.Unlock()
+
+	//有界负载：容量为(总调用数+1)/服务数*LoadFactor，向上取整
+	capacity := math.MaxInt32
+	if opt != nil && opt.LoadFactor > 1 && len(servers) > 0 {
+		total := 1
+		for _, s := range servers {
+			total += xc.pending(s)
+		}
+		capacity = int(math.Ceil(float64(total) * opt.LoadFactor / float64(len(servers))))
+	}
+
+	ring := xc.hashRing(servers)
+	if s, ok := ring.get(key, func(addr string) bool {
+		return exclude[addr] || xc.pending(addr) >= capacity || !xc.allow(addr)
+	}); ok {
+		return s, nil
+	}
+	//都失败过或者都超过了容量时，忽略这两个限制再选一次
+	if s, ok := ring.get(key, func(addr string) bool { return !xc.allow(addr) }); ok {
+		return s, nil
+	}
+	return "", ErrAllBreakersOpen
+}
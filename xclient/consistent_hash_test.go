@@ -0,0 +1,146 @@
+package xclient
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHashRing_MinimalRebalance(t *testing.T) {
+	servers := []string{"tcp@a", "tcp@b", "tcp@c"}
+	ring := newHashRing(servers, 100)
+
+	before := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		s, ok := ring.get(key, nil)
+		if !ok {
+			t.Fatal("expect a server")
+		}
+		if s2, _ := ring.get(key, nil); s2 != s {
+			t.Fatalf("key %s maps to %s and %s", key, s, s2)
+		}
+		before[key] = s
+		counts[s]++
+	}
+	for _, s := range servers {
+		if counts[s] < 150 {
+			t.Fatalf("unbalanced ring %v", counts)
+		}
+	}
+
+	//新增服务后，key要么不变，要么迁移到新服务上
+	ring = newHashRing(append(servers, "tcp@d"), 100)
+	moved := 0
+	for key, s := range before {
+		got, _ := ring.get(key, nil)
+		if got != s {
+			if got != "tcp@d" {
+				t.Fatalf("key %s moved from %s to %s", key, s, got)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 400 {
+		t.Fatalf("unexpected moved keys %d", moved)
+	}
+
+	//跳过的服务顺延到下一个
+	key := "user-1"
+	home, _ := ring.get(key, nil)
+	next, _ := ring.get(key, func(addr string) bool { return addr == home })
+	if next == home || next == "" {
+		t.Fatalf("expect another server than %s, got %s", home, next)
+	}
+}
+
+type userArgs struct {
+	Num1 int
+	Num2 int
+	user string
+}
+
+func (a *userArgs) HashKey() string {
+	return a.user
+}
+
+func TestXClient_ConsistentHashSelect(t *testing.T) {
+	var laggers []*Lagger
+	var servers []string
+	for i := 0; i < 3; i++ {
+		l, addr := startLaggerServer(t, 0)
+		laggers = append(laggers, l)
+		servers = append(servers, addr)
+	}
+	xc := NewXClient(NewMultiServerDiscovery(servers), ConsistentHashSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	served := func() []int32 {
+		var calls []int32
+		for _, l := range laggers {
+			calls = append(calls, atomic.LoadInt32(&l.calls))
+		}
+		return calls
+	}
+
+	ctx := WithHashKey(context.Background(), "user-42")
+	for i := 0; i < 5; i++ {
+		var reply int
+		if err := xc.Call(ctx, "Lagger.Do", &Args{Num1: i}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := served()
+	if calls[0]+calls[1]+calls[2] != 5 || (calls[0] != 5 && calls[1] != 5 && calls[2] != 5) {
+		t.Fatalf("expect all calls on one server, got %v", calls)
+	}
+
+	//参数实现HashKeyer时同样生效。gob只编码导出字段，user不会发给服务端
+	for i := 0; i < 5; i++ {
+		var reply int
+		if err := xc.Call(context.Background(), "Lagger.Do", &userArgs{user: "user-42"}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls = served()
+	if calls[0] != 10 && calls[1] != 10 && calls[2] != 10 {
+		t.Fatalf("expect HashKeyer to route to the same server, got %v", calls)
+	}
+}
+
+func TestXClient_ConsistentHashBoundedLoad(t *testing.T) {
+	var laggers []*Lagger
+	var servers []string
+	for i := 0; i < 3; i++ {
+		l, addr := startLaggerServer(t, time.Millisecond*200)
+		laggers = append(laggers, l)
+		servers = append(servers, addr)
+	}
+	xc := NewXClient(NewMultiServerDiscovery(servers), ConsistentHashSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetConsistentHashOption(&ConsistentHashOption{Replicas: 100, LoadFactor: 1.25})
+
+	ctx := WithHashKey(context.Background(), "hot-user")
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			if err := xc.Call(ctx, "Lagger.Do", &Args{}, &reply); err != nil {
+				t.Error(err)
+			}
+		}()
+		time.Sleep(time.Millisecond * 20)
+	}
+	wg.Wait()
+	for _, l := range laggers {
+		if calls := atomic.LoadInt32(&l.calls); calls > 3 {
+			t.Fatalf("bounded load exceeded: %d calls on one server", calls)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package xclient
+
+import (
+	"GeekRPC/client"
+	server2 "GeekRPC/server"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 替换xdial，地址中带有"slow"的拨号需要等待200ms，带有"bad"的拨号失败
+func stubDial(t *testing.T) *int32 {
+	var dials int32
+	xdial = func(rpcAddr string, opts ...*server2.Option) (*client.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		if strings.Contains(rpcAddr, "slow") {
+			time.Sleep(time.Millisecond * 200)
+		}
+		if strings.Contains(rpcAddr, "bad") {
+			return nil, errors.New("dial failed")
+		}
+		return client.XDial(strings.Split(rpcAddr, "#")[0], opts...)
+	}
+	t.Cleanup(func() { xdial = client.XDial })
+	return &dials
+}
+
+func TestXClient_DialSingleFlight(t *testing.T) {
+	_, addr := startLaggerServer(t, 0)
+	dials := stubDial(t)
+	xc := NewXClient(NewMultiServerDiscovery(nil), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var wg sync.WaitGroup
+	clients := make([]*client.Client, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clt, err := xc.dial(context.Background(), addr+"#slow")
+			if err != nil {
+				t.Error(err)
+			}
+			clients[i] = clt
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(dials); n != 1 {
+		t.Fatalf("expect 1 dial, got %d", n)
+	}
+	for _, clt := range clients {
+		if clt != clients[0] {
+			t.Fatal("expect concurrent callers to share one client")
+		}
+	}
+}
+
+func TestXClient_DialInParallel(t *testing.T) {
+	_, addr := startLaggerServer(t, 0)
+	stubDial(t)
+	xc := NewXClient(NewMultiServerDiscovery(nil), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var wg sync.WaitGroup
+	defer wg.Wait() //慢拨号结束后才能恢复xdial
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = xc.dial(context.Background(), addr+"#slow")
+	}()
+	time.Sleep(time.Millisecond * 20)
+
+	start := time.Now()
+	if _, err := xc.dial(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost > time.Millisecond*100 {
+		t.Fatalf("dial blocked by another address for %s", cost)
+	}
+
+	//等待慢拨号的调用可以被ctx取消
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	go func() {
+		defer wg.Done()
+		_, _ = xc.dial(context.Background(), addr+"#slow2")
+	}()
+	time.Sleep(time.Millisecond * 10)
+	if _, err := xc.dial(ctx, addr+"#slow2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
+
+func TestXClient_DialFailureCache(t *testing.T) {
+	dials := stubDial(t)
+	xc := NewXClient(NewMultiServerDiscovery(nil), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetDialFailureTTL(time.Millisecond * 50)
+
+	for i := 0; i < 3; i++ {
+		if _, err := xc.dial(context.Background(), "tcp@bad"); err == nil {
+			t.Fatal("expect dial error")
+		}
+	}
+	if n := atomic.LoadInt32(dials); n != 1 {
+		t.Fatalf("expect failed dial to be cached, got %d dials", n)
+	}
+	time.Sleep(time.Millisecond * 60)
+	_, _ = xc.dial(context.Background(), "tcp@bad")
+	if n := atomic.LoadInt32(dials); n != 2 {
+		t.Fatalf("expect redial after ttl, got %d dials", n)
+	}
+}
+
+func TestXClient_DialCanceledWhileDialing(t *testing.T) {
+	_, addr := startLaggerServer(t, 0)
+	stubDial(t)
+	xc := NewXClient(NewMultiServerDiscovery(nil), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	//发起拨号的调用也可以被ctx取消，拨号在后台继续，结果留给之后的调用
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	start := time.Now()
+	if _, err := xc.dial(ctx, addr+"#slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if cost := time.Since(start); cost > time.Millisecond*100 {
+		t.Fatalf("canceled dial took %s", cost)
+	}
+	if _, err := xc.dial(context.Background(), addr+"#slow"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -13,19 +13,34 @@ type SelectMode int
 const(
 	RandomSelect SelectMode = iota
 	RoundRobinSelect
+	WeightedRoundRobinSelect //平滑加权轮询，权重来自Instance.Weight
+	//以下模式需要每个服务的负载信息，由XClient从GetAll的结果中选择，Discovery.Get不支持
+	LeastPendingSelect //随机选两个服务，取正在进行的调用更少的一个
+	LeastLatencySelect //随机选两个服务，取EWMA延迟更低的一个
+	ConsistentHashSelect //按WithHashKey或者参数的HashKey()做一致性哈希，同一个key总是落在同一个服务上
 )
 
+// Instance 是带权重的服务实例
+type Instance struct {
+	Addr string
+	Weight int //权重，小于等于0时按1处理
+}
+
 type Discovery interface {
 	Refresh()error
 	Update(servers []string)error
+	UpdateInstances(instances []Instance)error
 	Get(mode SelectMode)(string,error)
 	GetAll()([]string,error)
+	GetAllInstances()([]Instance,error)
 }
 
 type MultiServerDiscovery struct {
 	r *rand.Rand
 	mu sync.RWMutex
 	servers []string
+	weights map[string]int
+	currentWeights map[string]int //平滑加权轮询中每个服务当前的权重
 	index int
 }
 
@@ -38,6 +53,13 @@ func NewMultiServerDiscovery(servers []string) *MultiServerDiscovery {
 	return d
 }
 
+// NewWeightedMultiServerDiscovery 用静态配置的带权重的服务实例创建Discovery
+func NewWeightedMultiServerDiscovery(instances []Instance) *MultiServerDiscovery {
+	d := NewMultiServerDiscovery(nil)
+	d.setInstances(instances)
+	return d
+}
+
 var _ Discovery = (*MultiServerDiscovery)(nil)
 
 func (d *MultiServerDiscovery) Refresh () error {
@@ -48,9 +70,61 @@ func (d *MultiServerDiscovery) Update(servers []string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.servers = servers
+	d.weights = nil
+	d.currentWeights = nil
+	return nil
+}
+
+func (d *MultiServerDiscovery) UpdateInstances(instances []Instance) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setInstances(instances)
 	return nil
 }
 
+// 调用方需要持有d.mu
+func (d *MultiServerDiscovery) setInstances(instances []Instance) {
+	d.servers = make([]string,0,len(instances))
+	d.weights = make(map[string]int,len(instances))
+	for _,ins := range instances {
+		d.servers = append(d.servers,ins.Addr)
+		d.weights[ins.Addr] = ins.Weight
+	}
+	//保留仍然存在的服务的当前权重，避免每次更新都从头开始轮询
+	current := make(map[string]int,len(instances))
+	for _,s := range d.servers {
+		current[s] = d.currentWeights[s]
+	}
+	d.currentWeights = current
+}
+
+func (d *MultiServerDiscovery) weight(server string) int {
+	if w := d.weights[server]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// 平滑加权轮询：每次所有服务的当前权重加上各自的权重，选出当前权重最大的，
+// 再把它的当前权重减去总权重。这样权重为{5,1,1}时选出的顺序是a,a,b,a,c,a,a，不会连续选中同一个服务
+func (d *MultiServerDiscovery) nextWeighted() string {
+	if d.currentWeights == nil {
+		d.currentWeights = make(map[string]int,len(d.servers))
+	}
+	total := 0
+	best := ""
+	for _,s := range d.servers {
+		w := d.weight(s)
+		total += w
+		d.currentWeights[s] += w
+		if best == "" || d.currentWeights[s] > d.currentWeights[best] {
+			best = s
+		}
+	}
+	d.currentWeights[best] -= total
+	return best
+}
+
 func (d *MultiServerDiscovery) Get(mode SelectMode) (string, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -66,6 +140,8 @@ func (d *MultiServerDiscovery) Get(mode SelectMode) (string, error) {
 		s := d.servers[d.index % n]
 		d.index = (d.index + 1) % n
 		return s,nil
+	case WeightedRoundRobinSelect:
+		return d.nextWeighted(),nil
 	default:
 		return "",errors.New("rpc discovery: not supported select mode")
 	}
@@ -79,3 +155,14 @@ func (d *MultiServerDiscovery) GetAll() ([]string, error) {
 	copy(servers,d.servers)
 	return servers,nil
 }
+
+func (d *MultiServerDiscovery) GetAllInstances() ([]Instance, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	instances := make([]Instance,0,len(d.servers))
+	for _,s := range d.servers {
+		instances = append(instances,Instance{Addr: s,Weight: d.weight(s)})
+	}
+	return instances,nil
+}
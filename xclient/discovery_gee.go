@@ -1,71 +1,201 @@
 package xclient
 
 import (
+	"GeekRPC/registry"
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type GeeRegistryDiscovery struct {
 	*MultiServerDiscovery
-	registry string //注册中心的地址
+	registries []string //注册中心集群中各节点的地址，请求失败时切换到下一个节点
+	current int //正在使用的节点
 	timeout time.Duration //服务列表的过期时间
+	filter RegistryFilter
 	lastUpdate time.Time //最后从注册中心更新服务列表的时间
+	watching bool //watch请求正常时服务列表总是最新的，不需要定时拉取
+	stopWatch context.CancelFunc //停止watch协程，没有启用watch时为nil
+	watchDone chan struct{}
+}
+
+// RegistryFilter 决定从注册中心取哪些实例
+type RegistryFilter struct {
+	Service string //只取以该服务名注册的实例，为空时取所有实例
+	Selector map[string]string //实例的version、zone和tags都要满足selector
 }
 
 const defaultUpdateTimeout = time.Second * 10
 
-func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration) *GeeRegistryDiscovery {
+// registryClient 是请求注册中心的http客户端，节点挂起时不会一直阻塞，可以切换到其他节点
+var registryClient = &http.Client{Timeout: time.Second * 10}
+
+var errNoRegistry = errors.New("rpc registry: no registry address")
+
+// NewGeeRegistryDiscovery 创建定时从注册中心拉取服务列表的Discovery，filter最多一个
+func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration, filter ...*RegistryFilter) *GeeRegistryDiscovery {
+	return NewGeeRegistryClusterDiscovery([]string{registerAddr},timeout,filter...)
+}
+
+// NewGeeRegistryClusterDiscovery 与NewGeeRegistryDiscovery相同，registries是同一个注册中心集群的各个节点，
+// 当前节点请求失败时依次切换到下一个节点。registries为空时Refresh和Get都返回错误
+func NewGeeRegistryClusterDiscovery(registries []string, timeout time.Duration, filter ...*RegistryFilter) *GeeRegistryDiscovery {
 	if timeout == 0 {
 		timeout = defaultUpdateTimeout
 	}
 
 	d := &GeeRegistryDiscovery{
 		MultiServerDiscovery:NewMultiServerDiscovery(make([]string,0)),
-		registry: registerAddr,
+		registries: append([]string(nil),registries...),
 		timeout: timeout,
 	}
+	if len(filter) > 0 && filter[0] != nil {
+		d.filter = *filter[0]
+	}
 
 	return d
 }
 
 func (d *GeeRegistryDiscovery) Update(servers []string) error {
+	if err := d.MultiServerDiscovery.Update(servers); err != nil {
+		return err
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
-
-	d.servers = servers
 	d.lastUpdate = time.Now()
 	return nil
 }
 
-func (d *GeeRegistryDiscovery) Refresh() error {
+func (d *GeeRegistryDiscovery) UpdateInstances(instances []Instance) error {
+	if err := d.MultiServerDiscovery.UpdateInstances(instances); err != nil {
+		return err
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	d.lastUpdate = time.Now()
+	return nil
+}
 
-	if d.lastUpdate.Add(d.timeout).After(time.Now()) {
+func (d *GeeRegistryDiscovery) Refresh() error {
+	d.mu.Lock()
+	if d.watching || d.lastUpdate.Add(d.timeout).After(time.Now()) {
+		d.mu.Unlock()
 		return nil
 	}
+	registries,current := d.registries,d.current
+	d.mu.Unlock()
+	if len(registries) == 0 {
+		return errNoRegistry
+	}
+
+	//拉取时不持有d.mu，节点挂起时不会阻塞Update和watch协程
+	var err error
+	for i := 0; i < len(registries); i++ {
+		next := (current + i) % len(registries)
+		log.Println("rpc registry: refresh servers from registry",registries[next])
+
+		var instances []Instance
+		if instances,err = d.fetch(registries[next]); err == nil {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			//拉取期间watch协程可能已经切换了节点
+			if d.current == current {
+				d.current = next
+			}
+			d.setInstances(instances)
+			d.lastUpdate = time.Now()
+			return nil
+		}
+		log.Println("rpc registry refresh err: ",err)
+	}
+	return err
+
+}
 
-	log.Println("rpc registry: refresh servers from registry",d.registry)
+//切换到下一个注册中心节点，调用方需要持有d.mu
+func (d *GeeRegistryDiscovery) failover() {
+	d.current = (d.current + 1) % len(d.registries)
+}
 
-	resp,err := http.Get(d.registry)
+//从一个注册中心节点拉取服务列表
+func (d *GeeRegistryDiscovery) fetch(registry string) ([]Instance,error) {
+	u,err := d.registryURL(registry,"")
 	if err != nil {
-		log.Println("rpc registry refresh err: ",err)
-		return err
+		return nil,err
 	}
+	resp,err := registryClient.Get(u)
+	if err != nil {
+		return nil,err
+	}
+	return d.parseResponse(resp)
+}
 
-	servers := strings.Split(resp.Header.Get("X-Geerpc-Servers"),",")
-	d.servers = make([]string,0,len(servers))
-	for _,server := range servers {
-		if strings.TrimSpace(server) != "" {
-			d.servers = append(d.servers,strings.TrimSpace(server))
-		}
+//拼出请求注册中心的URL，revision不为空时是watch请求
+func (d *GeeRegistryDiscovery) registryURL(registry, revision string) (string,error) {
+	u,err := url.Parse(registry)
+	if err != nil {
+		return "",err
 	}
+	q := u.Query()
+	if d.filter.Service != "" {
+		q.Set("service",d.filter.Service)
+	}
+	if revision != "" {
+		q.Set("revision",revision)
+		q.Set("wait",defaultWatchWait.String())
+	}
+	u.RawQuery = q.Encode()
+	return u.String(),nil
+}
 
-	d.lastUpdate = time.Now()
-	return nil
+//从注册中心的响应中解析满足filter的服务实例并关闭body
+func (d *GeeRegistryDiscovery) parseResponse(resp *http.Response) ([]Instance,error) {
+	defer func() { _ = resp.Body.Close() }()
+	//老版本的注册中心只在header中返回地址
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"),"application/json") {
+		return parseInstances(resp.Header),nil
+	}
+
+	var body registry.ServersResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body);err != nil {
+		return nil,err
+	}
+	instances := make([]Instance,0,len(body.Servers))
+	seen := make(map[string]bool,len(body.Servers))
+	for i := range body.Servers {
+		s := &body.Servers[i]
+		if !s.Serves(d.filter.Service) || !s.Match(d.filter.Selector) || seen[s.Addr] {
+			continue
+		}
+		seen[s.Addr] = true
+		instances = append(instances,Instance{Addr: s.Addr,Weight: s.Weight})
+	}
+	return instances,nil
+}
 
+//从注册中心的响应header中解析服务实例
+func parseInstances(h http.Header) []Instance {
+	//X-Geerpc-Weights与X-Geerpc-Servers一一对应，老版本的注册中心没有这个header
+	servers := strings.Split(h.Get("X-Geerpc-Servers"),",")
+	weights := strings.Split(h.Get("X-Geerpc-Weights"),",")
+	instances := make([]Instance,0,len(servers))
+	for i,server := range servers {
+		if strings.TrimSpace(server) == "" {
+			continue
+		}
+		ins := Instance{Addr: strings.TrimSpace(server)}
+		if len(weights) == len(servers) {
+			ins.Weight,_ = strconv.Atoi(strings.TrimSpace(weights[i]))
+		}
+		instances = append(instances,ins)
+	}
+	return instances
 }
 
 func (d *GeeRegistryDiscovery) Get(mode SelectMode) (string, error) {
@@ -83,3 +213,11 @@ func (d *GeeRegistryDiscovery) GetAll() ([]string, error) {
 
 	return d.MultiServerDiscovery.GetAll()
 }
+
+func (d *GeeRegistryDiscovery) GetAllInstances() ([]Instance, error) {
+	if err := d.Refresh(); err != nil {
+		return nil,err
+	}
+
+	return d.MultiServerDiscovery.GetAllInstances()
+}
@@ -0,0 +1,127 @@
+package xclient
+
+import (
+	"GeekRPC/registry"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMultiServerDiscovery_WeightedRoundRobin(t *testing.T) {
+	d := NewWeightedMultiServerDiscovery([]Instance{
+		{Addr: "a", Weight: 5},
+		{Addr: "b", Weight: 1},
+		{Addr: "c", Weight: 1},
+	})
+
+	var got []string
+	for i := 0; i < 14; i++ {
+		s, err := d.Get(WeightedRoundRobinSelect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s)
+	}
+	if seq := strings.Join(got, ""); seq != "aabacaaaabacaa" {
+		t.Fatalf("unexpected weighted sequence %s", seq)
+	}
+
+	//没有设置权重时退化为普通轮询
+	_ = d.Update([]string{"a", "b"})
+	got = got[:0]
+	for i := 0; i < 4; i++ {
+		s, _ := d.Get(WeightedRoundRobinSelect)
+		got = append(got, s)
+	}
+	if seq := strings.Join(got, ""); seq != "abab" && seq != "baba" {
+		t.Fatalf("unexpected sequence %s", seq)
+	}
+}
+
+func TestGeeRegistryDiscovery_Weights(t *testing.T) {
+	r := registry.New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for addr, weight := range map[string]string{"tcp@a": "3", "tcp@b": "1", "tcp@c": ""} {
+		req, _ := http.NewRequest("POST", ts.URL, nil)
+		req.Header.Set("X-Geerpc-Server", addr)
+		req.Header.Set("X-Geerpc-Weight", weight)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	d := NewGeeRegistryDiscovery(ts.URL, 0)
+	instances, err := d.GetAllInstances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Instance{{"tcp@a", 3}, {"tcp@b", 1}, {"tcp@c", 1}}
+	if len(instances) != len(expect) {
+		t.Fatalf("expect %v, got %v", expect, instances)
+	}
+	for i := range expect {
+		if instances[i] != expect[i] {
+			t.Fatalf("expect %v, got %v", expect, instances)
+		}
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		s, _ := d.Get(WeightedRoundRobinSelect)
+		counts[s]++
+	}
+	if counts["tcp@a"] != 6 || counts["tcp@b"] != 2 || counts["tcp@c"] != 2 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+}
+
+func TestGeeRegistryDiscovery_ServiceFilter(t *testing.T) {
+	r := registry.New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, item := range []registry.ServerItem{
+		{Service: "Foo", Addr: "tcp@a", Version: "v1", Zone: "z1", Tags: map[string]string{"env": "prod"}},
+		{Service: "Foo", Addr: "tcp@b", Version: "v2", Zone: "z1", Tags: map[string]string{"env": "prod"}},
+		{Service: "Foo", Addr: "tcp@c", Version: "v1", Zone: "z2", Tags: map[string]string{"env": "test"}},
+		{Service: "Bar", Addr: "tcp@a", Version: "v1", Zone: "z1"},
+		{Service: "Bar", Addr: "tcp@d", Version: "v1", Zone: "z1"},
+		{Addr: "tcp@e", Version: "v1", Zone: "z2"}, //没有服务名，提供所有服务
+	} {
+		body, _ := json.Marshal(&item)
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	cases := []struct {
+		filter *RegistryFilter
+		expect string
+	}{
+		{nil, "tcp@a,tcp@b,tcp@c,tcp@d,tcp@e"},
+		{&RegistryFilter{Service: "Foo"}, "tcp@a,tcp@b,tcp@c,tcp@e"},
+		{&RegistryFilter{Service: "Bar"}, "tcp@a,tcp@d,tcp@e"},
+		{&RegistryFilter{Service: "Baz"}, "tcp@e"},
+		{&RegistryFilter{Service: "Foo", Selector: map[string]string{"version": "v1"}}, "tcp@a,tcp@c,tcp@e"},
+		{&RegistryFilter{Service: "Foo", Selector: map[string]string{"zone": "z1", "env": "prod"}}, "tcp@a,tcp@b"},
+		{&RegistryFilter{Service: "Foo", Selector: map[string]string{"env": "staging"}}, ""},
+	}
+	for _, c := range cases {
+		servers, err := NewGeeRegistryDiscovery(ts.URL, 0, c.filter).GetAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(servers, ","); got != c.expect {
+			t.Fatalf("filter %+v: expect %s, got %s", c.filter, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultWatchWait    = time.Second * 30 //单个watch请求最多挂起多久，与注册中心的上限相同
+	watchInitialBackoff = time.Second
+	watchMaxBackoff     = time.Second * 30
+)
+
+// NewGeeRegistryWatchDiscovery 创建通过watch请求订阅注册中心的Discovery，服务列表变化时立即更新。
+// watch失败时退回到每隔timeout拉取一次，并在退避后重新watch
+func NewGeeRegistryWatchDiscovery(registerAddr string, timeout time.Duration, filter ...*RegistryFilter) *GeeRegistryDiscovery {
+	return NewGeeRegistryClusterWatchDiscovery([]string{registerAddr}, timeout, filter...)
+}
+
+// NewGeeRegistryClusterWatchDiscovery 与NewGeeRegistryWatchDiscovery相同，watch失败时先切换到集群中的其他节点，
+// 所有节点都失败时才退回到拉取
+func NewGeeRegistryClusterWatchDiscovery(registries []string, timeout time.Duration, filter ...*RegistryFilter) *GeeRegistryDiscovery {
+	d := NewGeeRegistryClusterDiscovery(registries, timeout, filter...)
+	if len(d.registries) == 0 {
+		//没有可以watch的节点，Refresh会返回错误
+		return d
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stopWatch = cancel
+	d.watchDone = make(chan struct{})
+	go d.watchLoop(ctx)
+	return d
+}
+
+// Close 停止watch协程，没有启用watch时什么也不做
+func (d *GeeRegistryDiscovery) Close() error {
+	if d.stopWatch != nil {
+		d.stopWatch()
+		<-d.watchDone
+	}
+	return nil
+}
+
+func (d *GeeRegistryDiscovery) watchLoop(ctx context.Context) {
+	defer close(d.watchDone)
+	httpClient := &http.Client{Timeout: defaultWatchWait + time.Second*10}
+	revision := "" //为空时先拉取一次完整的服务列表
+	backoff := watchInitialBackoff
+	failures := 0 //连续失败的节点数
+	for {
+		rev, err := d.watchOnce(ctx, httpClient, revision)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			revision = rev
+			backoff = watchInitialBackoff
+			failures = 0
+			continue
+		}
+
+		//revision是每个节点自己的，换了节点要重新拉取完整的服务列表
+		revision = ""
+		d.mu.Lock()
+		d.watching = false
+		d.failover()
+		d.mu.Unlock()
+		if failures++; failures < len(d.registries) {
+			log.Println("rpc registry: watch err, switch to next registry:", err)
+			continue
+		}
+		failures = 0
+
+		log.Println("rpc registry: watch err, fall back to polling:", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > watchMaxBackoff {
+			backoff = watchMaxBackoff
+		}
+	}
+}
+
+// 发送一次watch请求，返回注册中心当前的revision
+func (d *GeeRegistryDiscovery) watchOnce(ctx context.Context, httpClient *http.Client, revision string) (string, error) {
+	d.mu.Lock()
+	registry := d.registries[d.current]
+	d.mu.Unlock()
+	u, err := d.registryURL(registry, revision)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return "", fmt.Errorf("registry returned %s", resp.Status)
+	}
+	rev := resp.Header.Get("X-Geerpc-Revision")
+	if rev == "" {
+		_ = resp.Body.Close()
+		return "", errors.New("registry does not support watch")
+	}
+	instances, err := d.parseResponse(resp)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rev != revision {
+		d.setInstances(instances)
+	}
+	d.lastUpdate = time.Now()
+	d.watching = true
+	return rev, nil
+}
@@ -0,0 +1,186 @@
+package xclient
+
+import (
+	"GeekRPC/registry"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func register(t *testing.T, registryAddr, addr string) {
+	if err := sendRegister(registryAddr, addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sendRegister(registryAddr, addr string) error {
+	req, _ := http.NewRequest("POST", registryAddr, nil)
+	req.Header.Set("X-Geerpc-Server", addr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// 等待d的服务列表变成n个
+func waitServers(t *testing.T, d Discovery, n int, within time.Duration) []string {
+	deadline := time.Now().Add(within)
+	for {
+		servers, _ := d.GetAll()
+		if len(servers) == n {
+			return servers
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d servers within %s, got %v", n, within, servers)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestGeeRegistryWatchDiscovery_PushUpdates(t *testing.T) {
+	r := registry.New(time.Millisecond * 300)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	defer ts.CloseClientConnections()
+
+	register(t, ts.URL, "tcp@a")
+	//拉取间隔设得很长，服务列表只能通过watch及时更新
+	d := NewGeeRegistryWatchDiscovery(ts.URL, time.Hour)
+	defer func() { _ = d.Close() }()
+	waitServers(t, d, 1, time.Second)
+
+	register(t, ts.URL, "tcp@b")
+	waitServers(t, d, 2, time.Millisecond*200)
+
+	//b不再发送心跳，过期后被推送下线
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond * 50):
+				_ = sendRegister(ts.URL, "tcp@a")
+			}
+		}
+	}()
+	if servers := waitServers(t, d, 1, time.Second); servers[0] != "tcp@a" {
+		t.Fatalf("expect tcp@a to stay, got %v", servers)
+	}
+}
+
+func TestGeeRegistryWatchDiscovery_FallbackToPolling(t *testing.T) {
+	r := registry.New(0)
+	//模拟不支持watch的注册中心
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("revision") != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.ServeHTTP(w, req)
+	}))
+	defer ts.Close()
+
+	register(t, ts.URL, "tcp@a")
+	d := NewGeeRegistryWatchDiscovery(ts.URL, time.Millisecond*50)
+	defer func() { _ = d.Close() }()
+	waitServers(t, d, 1, time.Second)
+
+	register(t, ts.URL, "tcp@b")
+	waitServers(t, d, 2, time.Second)
+}
+
+func TestGeeRegistryClusterDiscovery_Failover(t *testing.T) {
+	nodes := make([]*registry.GeeRegistry, 2)
+	servers := make([]*httptest.Server, 2)
+	for i := range nodes {
+		nodes[i] = registry.New(0)
+		servers[i] = httptest.NewServer(nodes[i])
+		defer servers[i].Close()
+	}
+	nodes[0].JoinCluster([]string{servers[1].URL}, time.Millisecond*20)
+	nodes[1].JoinCluster([]string{servers[0].URL}, time.Millisecond*20)
+	defer func() { _ = nodes[0].Close() }()
+	defer func() { _ = nodes[1].Close() }()
+
+	register(t, servers[0].URL, "tcp@a")
+	urls := []string{servers[0].URL, servers[1].URL}
+	polling := NewGeeRegistryClusterDiscovery(urls, time.Millisecond*50)
+	watching := NewGeeRegistryClusterWatchDiscovery(urls, time.Hour)
+	defer func() { _ = watching.Close() }()
+	waitServers(t, polling, 1, time.Second)
+	waitServers(t, watching, 1, time.Second)
+	//等待注册信息同步到第二个节点
+	waitServers(t, NewGeeRegistryDiscovery(servers[1].URL, time.Millisecond), 1, time.Second)
+
+	//第一个节点宕机后切换到第二个节点
+	servers[0].CloseClientConnections()
+	servers[0].Close()
+	_ = nodes[0].Close()
+	register(t, servers[1].URL, "tcp@b")
+	waitServers(t, polling, 2, time.Second)
+	waitServers(t, watching, 2, time.Second)
+}
+
+func TestGeeRegistryClusterDiscovery_NoRegistries(t *testing.T) {
+	polling := NewGeeRegistryClusterDiscovery(nil, 0)
+	watching := NewGeeRegistryClusterWatchDiscovery([]string{}, 0)
+	defer func() { _ = watching.Close() }()
+	for _, d := range []*GeeRegistryDiscovery{polling, watching} {
+		if err := d.Refresh(); err != errNoRegistry {
+			t.Fatalf("expect errNoRegistry from Refresh, got %v", err)
+		}
+		if _, err := d.Get(RandomSelect); err != errNoRegistry {
+			t.Fatalf("expect errNoRegistry from Get, got %v", err)
+		}
+	}
+}
+
+func TestGeeRegistryClusterDiscovery_RefreshDoesNotBlock(t *testing.T) {
+	//第一个节点挂起，直到测试结束才返回
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		panic(http.ErrAbortHandler)
+	}))
+	defer hung.Close()
+	defer close(release)
+	r := registry.New(0)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	register(t, ts.URL, "tcp@a")
+
+	d := NewGeeRegistryClusterDiscovery([]string{hung.URL, ts.URL}, time.Hour)
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- d.Refresh() }()
+	time.Sleep(time.Millisecond * 20)
+
+	//拉取挂起的节点时Update不会被阻塞
+	updated := make(chan error, 1)
+	go func() { updated <- d.Update([]string{"tcp@b"}) }()
+	select {
+	case err := <-updated:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect Update not to wait for a hung registry")
+	}
+
+	release <- struct{}{}
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+	servers, _ := d.MultiServerDiscovery.GetAll()
+	if len(servers) != 1 || servers[0] != "tcp@a" {
+		t.Fatalf("expect servers from the second registry, got %v", servers)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.current != 1 {
+		t.Fatalf("expect to switch to the second registry, got %d", d.current)
+	}
+}
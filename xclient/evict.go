@@ -0,0 +1,127 @@
+package xclient
+
+import (
+	"GeekRPC/client"
+	"log"
+	"time"
+)
+
+// EvictPolicy 描述XClient如何清理缓存的连接
+type EvictPolicy struct {
+	Interval     time.Duration //多久检查一次服务列表和空闲连接
+	IdleTimeout  time.Duration //连接空闲多久后关闭，0表示不关闭空闲连接
+	DrainTimeout time.Duration //服务下线后最多等待多久让进行中的调用结束，0表示defaultDrainTimeout
+}
+
+const defaultDrainTimeout = time.Second * 30
+
+var DefaultEvictPolicy = &EvictPolicy{
+	Interval:     time.Second * 10,
+	DrainTimeout: defaultDrainTimeout,
+}
+
+// SetEvictPolicy 设置连接清理策略，nil表示使用DefaultEvictPolicy。
+// 默认只关闭已经从Discovery中移除的服务的连接，设置IdleTimeout后才关闭空闲连接
+func (xc *XClient) SetEvictPolicy(p *EvictPolicy) {
+	if p == nil {
+		p = DefaultEvictPolicy
+	}
+	xc.mu.Lock()
+	xc.evictPolicy = p
+	xc.mu.Unlock()
+
+	//通知清理协程按新的间隔重新计时
+	select {
+	case xc.evictReset <- struct{}{}:
+	default:
+	}
+}
+
+// evictLoop 在NewXClient时启动，Close时退出
+func (xc *XClient) evictLoop() {
+	for {
+		xc.mu.Lock()
+		interval := xc.evictPolicy.Interval
+		xc.mu.Unlock()
+		if interval <= 0 {
+			interval = DefaultEvictPolicy.Interval
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+			xc.evict()
+		case <-xc.evictReset:
+		case <-xc.done:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// evict 关闭已经从Discovery中移除的服务的连接，以及空闲太久的连接
+func (xc *XClient) evict() {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		//拿不到服务列表时不能判断哪些服务下线了，只清理空闲连接
+		servers = nil
+	}
+	alive := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		alive[s] = true
+	}
+
+	xc.mu.Lock()
+	p := xc.evictPolicy
+	var departed []*client.Pool
+	for rpcAddr, entry := range xc.clients {
+		pool := entry.connPool()
+		if pool == nil {
+			//正在拨号，或者拨号失败的结果已经过期
+			if entry.err != nil && time.Since(entry.failedAt) >= xc.dialFailureTTL {
+				delete(xc.clients, rpcAddr)
+			}
+			continue
+		}
+		switch {
+		case err == nil && !alive[rpcAddr]:
+			log.Printf("rpc xclient: server %s left discovery, closing connection", rpcAddr)
+			departed = append(departed, pool)
+			delete(xc.clients, rpcAddr)
+		case p.IdleTimeout > 0 && time.Since(entry.lastUsed) > p.IdleTimeout && pool.NumPending() == 0:
+			_ = pool.Close()
+			delete(xc.clients, rpcAddr)
+		}
+	}
+	if err == nil {
+		for rpcAddr := range xc.breakers {
+			if !alive[rpcAddr] {
+				delete(xc.breakers, rpcAddr)
+			}
+		}
+		for rpcAddr := range xc.loads {
+			if !alive[rpcAddr] {
+				delete(xc.loads, rpcAddr)
+			}
+		}
+	}
+	xc.mu.Unlock()
+
+	drain := p.DrainTimeout
+	if drain <= 0 {
+		drain = defaultDrainTimeout
+	}
+	for _, pool := range departed {
+		go drainAndClose(pool, drain)
+	}
+}
+
+// 等待pool上进行中的调用结束后关闭连接，最多等待timeout
+func drainAndClose(pool *client.Pool, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for pool.NumPending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 50)
+	}
+	_ = pool.Close()
+}
@@ -0,0 +1,102 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func numClients(xc *XClient) int {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return len(xc.clients)
+}
+
+func TestXClient_EvictDepartedServers(t *testing.T) {
+	_, slow := startLaggerServer(t, time.Millisecond*200)
+	_, fast := startLaggerServer(t, 0)
+	d := NewMultiServerDiscovery([]string{slow, fast})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	if err := xc.Broadcast(context.Background(), "Lagger.Do", &Args{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if n := numClients(xc); n != 2 {
+		t.Fatalf("expect 2 cached clients, got %d", n)
+	}
+
+	xc.mu.Lock()
+	slowClient := xc.clients[slow].pool
+	xc.mu.Unlock()
+
+	//慢服务上有调用时下线，调用应该正常完成后再关闭连接
+	done := make(chan error, 1)
+	go func() {
+		var reply int
+		done <- xc.call(slow, context.Background(), "Lagger.Do", &Args{Num1: 1, Num2: 1}, &reply)
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	_ = d.Update([]string{fast})
+	xc.evict()
+	if n := numClients(xc); n != 1 {
+		t.Fatalf("expect 1 cached client after eviction, got %d", n)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight call should drain, got %v", err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	if slowClient.IsAvailable() {
+		t.Fatal("departed client should be closed after draining")
+	}
+}
+
+func TestXClient_EvictIdle(t *testing.T) {
+	_, addr := startLaggerServer(t, 0)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetEvictPolicy(&EvictPolicy{
+		Interval:    time.Millisecond * 20,
+		IdleTimeout: time.Millisecond * 50,
+	})
+
+	var reply int
+	if err := xc.Call(context.Background(), "Lagger.Do", &Args{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if n := numClients(xc); n != 1 {
+		t.Fatalf("expect 1 cached client, got %d", n)
+	}
+	time.Sleep(time.Millisecond * 200)
+	if n := numClients(xc); n != 0 {
+		t.Fatalf("expect idle client to be closed, got %d", n)
+	}
+	if err := xc.Call(context.Background(), "Lagger.Do", &Args{}, &reply); err != nil {
+		t.Fatalf("expect redial after idle eviction, got %v", err)
+	}
+}
+
+func TestXClient_EvictDepartedByDefault(t *testing.T) {
+	_, a := startLaggerServer(t, 0)
+	_, b := startLaggerServer(t, 0)
+	d := NewMultiServerDiscovery([]string{a, b})
+	xc := NewXClient(d, RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	if err := xc.Broadcast(context.Background(), "Lagger.Do", &Args{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	//默认清理下线服务的连接，但不关闭空闲连接
+	_ = d.Update([]string{b})
+	xc.evict()
+	xc.mu.Lock()
+	_, kept := xc.clients[b]
+	n := len(xc.clients)
+	xc.mu.Unlock()
+	if n != 1 || !kept {
+		t.Fatalf("expect only the connection to %s to be kept, got %d cached clients", b, n)
+	}
+}
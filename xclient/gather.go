@@ -0,0 +1,134 @@
+package xclient
+
+import (
+	"GeekRPC/server"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type GatherMode int
+
+const (
+	GatherAll        GatherMode = iota //等待所有服务返回，有任何一个失败都返回错误
+	GatherQuorum                       //成功数达到Quorum后立即返回，并取消剩余的调用
+	GatherBestEffort                   //忽略失败的服务，至少有一个成功即可
+)
+
+// GatherResult 是一个服务的调用结果
+type GatherResult struct {
+	Addr  string
+	Reply interface{} //与Gather的reply类型相同的指针，调用失败时为nil
+	Err   error
+}
+
+// Reducer 把所有成功的reply合并到reply中，replies按服务在GetAll中的顺序排列
+type Reducer func(replies []interface{}, reply interface{}) error
+
+type GatherOption struct {
+	Mode    GatherMode
+	Quorum  int     //GatherQuorum模式下需要成功的服务数，0表示超过半数，超过服务数时直接返回错误
+	Reducer Reducer //为nil时把第一个成功的reply复制到reply中
+}
+
+// ErrQuorumReached 是达到quorum后被取消的调用在GatherResult中的错误
+var ErrQuorumReached error = server.NewError(server.CodeCanceled, "rpc xclient: call canceled after quorum reached")
+
+// Gather 调用所有服务并返回每个服务的结果和错误，按照opt.Mode决定什么时候返回、是否算作失败。
+// reply为nil时只关心调用是否成功
+func (xc *XClient) Gather(ctx context.Context, serviceMethod string, args, reply interface{}, opt *GatherOption) ([]*GatherResult, error) {
+	if opt == nil {
+		opt = &GatherOption{}
+	}
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, server.NewError(server.CodeUnavailable, "rpc discovery: no available servers")
+	}
+	quorum := opt.Quorum
+	if quorum <= 0 {
+		quorum = len(servers)/2 + 1
+	}
+	if opt.Mode == GatherQuorum && quorum > len(servers) {
+		return nil, server.Errorf(server.CodeUnavailable,
+			"rpc xclient: quorum %d exceeds the number of servers %d", quorum, len(servers))
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*GatherResult, len(servers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	succeeded := 0
+	quorumReached := false
+	for i, rpcAddr := range servers {
+		wg.Add(1)
+		go func(i int, rpcAddr string) {
+			defer wg.Done()
+			var cloneReply interface{}
+			if reply != nil {
+				cloneReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.call(rpcAddr, ctx, serviceMethod, args, cloneReply)
+
+			mu.Lock()
+			defer mu.Unlock()
+			r := &GatherResult{Addr: rpcAddr, Err: err}
+			if err == nil {
+				r.Reply = cloneReply
+				succeeded++
+			}
+			//只有因为达到quorum而被取消的调用才标记为ErrQuorumReached，其他错误保持原样
+			if quorumReached && parent.Err() == nil && server.CodeOf(err) == server.CodeCanceled {
+				r.Err = ErrQuorumReached
+			}
+			if opt.Mode == GatherQuorum && succeeded >= quorum && !quorumReached {
+				//已经达到quorum，剩下的调用不再需要
+				quorumReached = true
+				cancel()
+			}
+			results[i] = r
+		}(i, rpcAddr)
+	}
+	wg.Wait()
+
+	var replies []interface{}
+	var firstErr error
+	for _, r := range results {
+		if r.Err == nil {
+			replies = append(replies, r.Reply)
+		} else if firstErr == nil && r.Err != ErrQuorumReached {
+			firstErr = fmt.Errorf("rpc xclient: %s: %w", r.Addr, r.Err)
+		}
+	}
+
+	switch opt.Mode {
+	case GatherAll:
+		if firstErr != nil {
+			return results, firstErr
+		}
+	case GatherQuorum:
+		if succeeded < quorum {
+			return results, server.Errorf(server.CodeUnavailable,
+				"rpc xclient: quorum not reached: %d of %d succeeded, need %d, first error: %v", succeeded, len(servers), quorum, firstErr)
+		}
+	case GatherBestEffort:
+		if succeeded == 0 {
+			return results, firstErr
+		}
+	}
+
+	if reply == nil {
+		return results, nil
+	}
+	if opt.Reducer != nil {
+		return results, opt.Reducer(replies, reply)
+	}
+	reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(replies[0]).Elem())
+	return results, nil
+}
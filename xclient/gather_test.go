@@ -0,0 +1,106 @@
+package xclient
+
+import (
+	server2 "GeekRPC/server"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func sumReducer(replies []interface{}, reply interface{}) error {
+	sum := 0
+	for _, r := range replies {
+		sum += *r.(*int)
+	}
+	*reply.(*int) = sum
+	return nil
+}
+
+func TestXClient_Gather(t *testing.T) {
+	_, good1 := startFlakyServer(t, false)
+	_, good2 := startFlakyServer(t, false)
+	_, bad := startFlakyServer(t, true)
+	xc := NewXClient(NewMultiServerDiscovery([]string{good1, bad, good2}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	results, err := xc.Gather(context.Background(), "Flaky.Do", &Args{Num1: 1, Num2: 2}, &reply, nil)
+	if err == nil {
+		t.Fatal("expect GatherAll to fail")
+	}
+	if len(results) != 3 || results[0].Addr != good1 || results[1].Err == nil || *results[2].Reply.(*int) != 3 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	reply = 0
+	_, err = xc.Gather(context.Background(), "Flaky.Do", &Args{Num1: 1, Num2: 2}, &reply, &GatherOption{
+		Mode:    GatherBestEffort,
+		Reducer: sumReducer,
+	})
+	if err != nil || reply != 6 {
+		t.Fatalf("expect 6, got %d, err %v", reply, err)
+	}
+
+	_, err = xc.Gather(context.Background(), "Flaky.Do", &Args{}, &reply, &GatherOption{Mode: GatherQuorum, Quorum: 3})
+	if err == nil {
+		t.Fatal("expect quorum of 3 to fail")
+	}
+	if _, err = xc.Gather(context.Background(), "Flaky.Do", &Args{}, nil, &GatherOption{Mode: GatherQuorum}); err != nil {
+		t.Fatalf("expect majority quorum to succeed, got %v", err)
+	}
+}
+
+func TestXClient_GatherQuorumCancelsSlowServers(t *testing.T) {
+	_, fast1 := startLaggerServer(t, 0)
+	_, fast2 := startLaggerServer(t, 0)
+	_, slow := startLaggerServer(t, time.Millisecond*500)
+	xc := NewXClient(NewMultiServerDiscovery([]string{fast1, fast2, slow}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	start := time.Now()
+	results, err := xc.Gather(context.Background(), "Lagger.Do", &Args{Num1: 2, Num2: 3}, &reply, &GatherOption{Mode: GatherQuorum})
+	if err != nil || reply != 5 {
+		t.Fatalf("expect 5, got %d, err %v", reply, err)
+	}
+	if cost := time.Since(start); cost > time.Millisecond*300 {
+		t.Fatalf("quorum gather took %s", cost)
+	}
+	if results[2].Err != ErrQuorumReached {
+		t.Fatalf("expect slow server to be canceled, got %v", results[2].Err)
+	}
+}
+
+func TestXClient_GatherQuorumExceedsServers(t *testing.T) {
+	flaky, addr := startFlakyServer(t, false)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr, addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	_, err := xc.Gather(context.Background(), "Flaky.Do", &Args{}, nil, &GatherOption{Mode: GatherQuorum, Quorum: 3})
+	if server2.CodeOf(err) != server2.CodeUnavailable {
+		t.Fatalf("expect quorum larger than servers to fail, got %v", err)
+	}
+	if n := atomic.LoadInt32(&flaky.calls); n != 0 {
+		t.Fatalf("expect no calls, got %d", n)
+	}
+}
+
+func TestXClient_GatherQuorumCancelsSlowDial(t *testing.T) {
+	_, addr := startLaggerServer(t, 0)
+	stubDial(t)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr, addr + "#slow"}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	start := time.Now()
+	results, err := xc.Gather(context.Background(), "Lagger.Do", &Args{Num1: 1, Num2: 1}, nil, &GatherOption{Mode: GatherQuorum, Quorum: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost > time.Millisecond*100 {
+		t.Fatalf("quorum gather waited for the slow dial for %s", cost)
+	}
+	if results[1].Err != ErrQuorumReached {
+		t.Fatalf("expect slow dial to be canceled, got %v", results[1].Err)
+	}
+}
@@ -0,0 +1,129 @@
+package xclient
+
+import (
+	"GeekRPC/server"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// HealthCheckPolicy 描述XClient如何定时调用服务的Health.Check，
+// 返回NOT_SERVING的服务在恢复之前不会被选中
+type HealthCheckPolicy struct {
+	Interval time.Duration //检查间隔
+	Timeout  time.Duration //单次检查的超时时间
+	Service  string        //检查的服务名，为空表示检查整个Server
+}
+
+var DefaultHealthCheckPolicy = &HealthCheckPolicy{
+	Interval: time.Second * 5,
+	Timeout:  time.Second,
+}
+
+type healthChecker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// SetHealthCheckPolicy 开启健康检查，nil表示关闭。健康检查会让连接保持在使用中，不会被当作空闲连接关闭。
+// 没有注册Health服务或者检查失败的服务不会被标记，连接错误交给熔断器处理
+func (xc *XClient) SetHealthCheckPolicy(p *HealthCheckPolicy) {
+	xc.mu.Lock()
+	old := xc.healthCheck
+	xc.healthCheck = nil
+	xc.mu.Unlock()
+	if old != nil {
+		old.cancel()
+		<-old.done
+	}
+
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.unhealthy = make(map[string]bool)
+	if p == nil {
+		return
+	}
+	select {
+	case <-xc.done:
+		return
+	default:
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	xc.healthCheck = &healthChecker{cancel: cancel, done: make(chan struct{})}
+	go xc.healthCheckLoop(ctx, *p, xc.healthCheck.done)
+}
+
+func (xc *XClient) healthy(rpcAddr string) bool {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return !xc.unhealthy[rpcAddr]
+}
+
+func (xc *XClient) healthCheckLoop(ctx context.Context, p HealthCheckPolicy, done chan struct{}) {
+	defer close(done)
+	if p.Interval <= 0 {
+		p.Interval = DefaultHealthCheckPolicy.Interval
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultHealthCheckPolicy.Timeout
+	}
+	for {
+		xc.checkAll(ctx, &p)
+		select {
+		case <-time.After(p.Interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (xc *XClient) checkAll(ctx context.Context, p *HealthCheckPolicy) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return
+	}
+	var mu sync.Mutex
+	unhealthy := make(map[string]bool)
+	var wg sync.WaitGroup
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			status, err := xc.checkHealth(ctx, rpcAddr, p)
+			if err != nil || status == server.StatusServing {
+				return
+			}
+			mu.Lock()
+			unhealthy[rpcAddr] = true
+			mu.Unlock()
+		}(rpcAddr)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for rpcAddr := range unhealthy {
+		if !xc.unhealthy[rpcAddr] {
+			log.Printf("rpc xclient: server %s is not serving", rpcAddr)
+		}
+	}
+	xc.unhealthy = unhealthy
+}
+
+func (xc *XClient) checkHealth(ctx context.Context, rpcAddr string, p *HealthCheckPolicy) (server.ServingStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	clt, err := xc.dial(ctx, rpcAddr)
+	if err != nil {
+		return server.StatusUnknown, err
+	}
+	var resp server.HealthCheckResponse
+	if err := clt.Call(ctx, server.HealthCheckMethod, server.HealthCheckRequest{Service: p.Service}, &resp); err != nil {
+		return server.StatusUnknown, err
+	}
+	return resp.Status, nil
+}
@@ -0,0 +1,64 @@
+package xclient
+
+import (
+	server2 "GeekRPC/server"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startHealthServer(t *testing.T) (*Lagger, string, *server2.HealthServer) {
+	lagger := &Lagger{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	server := server2.NewServer()
+	_ = server.Register(lagger)
+	health, _ := server.RegisterHealth()
+	go server.Accept(l)
+	return lagger, "tcp@" + l.Addr().String(), health
+}
+
+func TestXClient_HealthAwareRouting(t *testing.T) {
+	draining, drainingAddr, health := startHealthServer(t)
+	serving, servingAddr, _ := startHealthServer(t)
+	//没有注册Health服务的服务视为健康
+	plain, plainAddr := startLaggerServer(t, 0)
+	xc := NewXClient(NewMultiServerDiscovery([]string{drainingAddr, servingAddr, plainAddr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	health.SetServingStatus("", server2.StatusNotServing)
+	xc.SetHealthCheckPolicy(&HealthCheckPolicy{Interval: time.Millisecond * 20, Timeout: time.Second})
+	waitFor := func(cond func() bool) {
+		deadline := time.Now().Add(time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("condition not met in time")
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+	waitFor(func() bool { return !xc.healthy(drainingAddr) })
+
+	for i := 0; i < 6; i++ {
+		var reply int
+		if err := xc.Call(context.Background(), "Lagger.Do", &Args{Num1: i}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&draining.calls); n != 0 {
+		t.Fatalf("expect no calls to the server that is not serving, got %d", n)
+	}
+	if atomic.LoadInt32(&serving.calls) == 0 || atomic.LoadInt32(&plain.calls) == 0 {
+		t.Fatal("expect calls to be spread over the serving servers")
+	}
+
+	//恢复后重新参与选择
+	health.SetServingStatus("", server2.StatusServing)
+	waitFor(func() bool { return xc.healthy(drainingAddr) })
+	xc.SetHealthCheckPolicy(nil)
+}
@@ -0,0 +1,167 @@
+package xclient
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy 描述对冲请求：调用超过一定时间还没返回时，向另一台服务再发一次相同的请求，
+// 取先成功的结果并取消另一个。只适用于幂等的方法
+type HedgePolicy struct {
+	Delay      time.Duration   //发出对冲请求前等待的时间
+	Percentile float64         //取值(0,1)时，用该方法历史延迟的分位数作为等待时间，样本不足时仍使用Delay
+	MinSamples int             //使用Percentile前至少需要的样本数
+	Methods    map[string]bool //可以对冲的方法，键为"Service.Method"
+}
+
+const latencyWindow = 128
+
+// latencyTracker 记录每个方法最近latencyWindow次成功调用的耗时
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		samples: make(map[string][]time.Duration),
+		next:    make(map[string]int),
+	}
+}
+
+func (t *latencyTracker) add(serviceMethod string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.samples[serviceMethod]
+	if len(s) < latencyWindow {
+		t.samples[serviceMethod] = append(s, d)
+		return
+	}
+	i := t.next[serviceMethod]
+	s[i] = d
+	t.next[serviceMethod] = (i + 1) % latencyWindow
+}
+
+func (t *latencyTracker) percentile(serviceMethod string, p float64, minSamples int) (time.Duration, bool) {
+	t.mu.Lock()
+	s := append([]time.Duration(nil), t.samples[serviceMethod]...)
+	t.mu.Unlock()
+
+	if len(s) == 0 || len(s) < minSamples {
+		return 0, false
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[int(float64(len(s)-1)*p)], true
+}
+
+// SetHedgePolicy 设置对冲请求策略，nil表示不对冲
+func (xc *XClient) SetHedgePolicy(p *HedgePolicy) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.hedge = p
+}
+
+func (xc *XClient) hedgeDelay(p *HedgePolicy, serviceMethod string) time.Duration {
+	if p.Percentile > 0 && p.Percentile < 1 {
+		if d, ok := xc.latency.percentile(serviceMethod, p.Percentile, p.MinSamples); ok {
+			return d
+		}
+	}
+	return p.Delay
+}
+
+// 从GetAll中随机选一台不同于primary且没有熔断的服务
+func (xc *XClient) pickHedge(primary string) (string, bool) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return "", false
+	}
+	var candidates []string
+	for _, s := range servers {
+		if s != primary {
+			candidates = append(candidates, s)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	for _, s := range candidates {
+		if xc.allow(s) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+type hedgeResult struct {
+	leg   int //第几个请求
+	reply interface{}
+	sent  bool
+	err   error
+}
+
+// 调用rpcAddr，按照策略在超过等待时间后向另一台服务发出对冲请求，返回先成功的结果
+func (xc *XClient) hedgedCall(p *HedgePolicy, rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() //返回时取消还没结束的请求
+
+	results := make(chan hedgeResult, 2)
+	var starts []time.Time //每个请求的开始时间
+	var finished []bool
+	launch := func(addr string) {
+		var cloneReply interface{}
+		if reply != nil {
+			cloneReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+		}
+		leg := len(starts)
+		starts, finished = append(starts, time.Now()), append(finished, false)
+		go func() {
+			sent, err := xc.tryCall(addr, ctx, serviceMethod, args, cloneReply)
+			results <- hedgeResult{leg: leg, reply: cloneReply, sent: sent, err: err}
+		}()
+	}
+
+	launch(rpcAddr)
+	inflight := 1
+	timer := time.NewTimer(xc.hedgeDelay(p, serviceMethod))
+	defer timer.Stop()
+
+	var sent bool
+	var lastErr error
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			if hedgeAddr, ok := xc.pickHedge(rpcAddr); ok {
+				launch(hedgeAddr)
+				inflight++
+			}
+		case r := <-results:
+			inflight--
+			finished[r.leg] = true
+			sent = sent || r.sent
+			if r.err == nil {
+				//被取消的慢请求至少已经用了这么久，记下来作为下限，否则分位数会偏低，对冲发得过早
+				for i, start := range starts {
+					if !finished[i] {
+						xc.latency.add(serviceMethod, time.Since(start))
+					}
+				}
+				if reply != nil {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(r.reply).Elem())
+				}
+				return sent, nil
+			}
+			lastErr = r.err
+			if inflight == 0 {
+				//第一个请求在对冲之前就失败了，交给重试策略处理
+				return sent, lastErr
+			}
+		}
+	}
+	return sent, lastErr
+}
@@ -0,0 +1,109 @@
+package xclient
+
+import (
+	server2 "GeekRPC/server"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Lagger struct {
+	delay time.Duration
+	calls int32
+}
+
+func (l *Lagger) Do(args Args, reply *int) error {
+	atomic.AddInt32(&l.calls, 1)
+	time.Sleep(l.delay)
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func startLaggerServer(t *testing.T, delay time.Duration) (*Lagger, string) {
+	lagger := &Lagger{delay: delay}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := server2.NewServer()
+	_ = server.Register(lagger)
+	go server.Accept(l)
+	return lagger, "tcp@" + l.Addr().String()
+}
+
+func TestXClient_Hedge(t *testing.T) {
+	slow, slowAddr := startLaggerServer(t, time.Millisecond*500)
+	fast, fastAddr := startLaggerServer(t, 0)
+	xc := NewXClient(NewMultiServerDiscovery([]string{slowAddr, fastAddr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy(&HedgePolicy{
+		Delay:   time.Millisecond * 20,
+		Methods: map[string]bool{"Lagger.Do": true},
+	})
+
+	for i := 0; i < 4; i++ {
+		var reply int
+		start := time.Now()
+		if err := xc.Call(context.Background(), "Lagger.Do", &Args{Num1: i, Num2: 1}, &reply); err != nil || reply != i+1 {
+			t.Fatalf("expect %d, got %d, err %v", i+1, reply, err)
+		}
+		if cost := time.Since(start); cost > time.Millisecond*300 {
+			t.Fatalf("hedged call took %s", cost)
+		}
+	}
+	//轮询时有一半的请求先发给了慢的服务，对冲请求都落在快的服务上
+	if s, f := atomic.LoadInt32(&slow.calls), atomic.LoadInt32(&fast.calls); s != 2 || f != 4 {
+		t.Fatalf("expect 2 slow calls and 4 fast calls, got %d and %d", s, f)
+	}
+	//被取消的慢请求也要记录耗时
+	xc.latency.mu.Lock()
+	samples := append([]time.Duration(nil), xc.latency.samples["Lagger.Do"]...)
+	xc.latency.mu.Unlock()
+	slowSamples := 0
+	for _, d := range samples {
+		if d >= time.Millisecond*20 {
+			slowSamples++
+		}
+	}
+	if len(samples) != 6 || slowSamples != 2 {
+		t.Fatalf("expect 6 samples with 2 from cancelled slow calls, got %v", samples)
+	}
+}
+
+func TestXClient_HedgeOnlyConfiguredMethods(t *testing.T) {
+	_, slowAddr := startLaggerServer(t, time.Millisecond*200)
+	fast, fastAddr := startLaggerServer(t, 0)
+	xc := NewXClient(NewMultiServerDiscovery([]string{slowAddr, fastAddr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy(&HedgePolicy{
+		Delay:   time.Millisecond * 20,
+		Methods: map[string]bool{"Other.Do": true},
+	})
+
+	for i := 0; i < 2; i++ {
+		var reply int
+		if err := xc.Call(context.Background(), "Lagger.Do", &Args{}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f := atomic.LoadInt32(&fast.calls); f != 1 {
+		t.Fatalf("expect 1 fast call, got %d", f)
+	}
+}
+
+func TestLatencyTracker_Percentile(t *testing.T) {
+	tracker := newLatencyTracker()
+	if _, ok := tracker.percentile("Foo.Sum", 0.9, 1); ok {
+		t.Fatal("expect no samples")
+	}
+	for i := 1; i <= latencyWindow+100; i++ {
+		tracker.add("Foo.Sum", time.Duration(i)*time.Millisecond)
+	}
+	d, ok := tracker.percentile("Foo.Sum", 0.5, 10)
+	//只保留最近latencyWindow个样本，即101ms到228ms
+	if !ok || d < time.Millisecond*160 || d > time.Millisecond*170 {
+		t.Fatalf("unexpected p50 %s", d)
+	}
+}
@@ -0,0 +1,37 @@
+package xclient
+
+import (
+	"GeekRPC/client"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestXClient_PoolGrowsUnderLoad(t *testing.T) {
+	_, addr := startLaggerServer(t, time.Millisecond*100)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetPoolOption(&client.PoolOption{MinSize: 1, MaxSize: 3, MaxPendingPerConn: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			if err := xc.Call(context.Background(), "Lagger.Do", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+				t.Error(err)
+			}
+		}()
+		time.Sleep(time.Millisecond * 20)
+	}
+	wg.Wait()
+
+	xc.mu.Lock()
+	pool := xc.clients[addr].pool
+	xc.mu.Unlock()
+	if n := pool.Len(); n < 2 || n > 3 {
+		t.Fatalf("expect pool to grow to 2..3 connections, got %d", n)
+	}
+}
@@ -0,0 +1,114 @@
+package xclient
+
+import (
+	"GeekRPC/server"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 描述XClient.Call失败后如何换一台服务重试
+type RetryPolicy struct {
+	MaxAttempts    int //最多调用多少次（包括第一次）
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64       //随机抖动比例，取值[0,1]
+	RetryableCodes []server.Code //可以重试的错误码，为空时只重试CodeUnavailable
+	// 幂等的方法，键为"Service.Method"。非幂等的方法只有在请求确定没有发出去时（比如连接失败）才会重试
+	IdempotentMethods map[string]bool
+	Budget            *RetryBudget //全局重试预算，为nil时不限制
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond * 50,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+func (p *RetryPolicy) retryable(code server.Code) bool {
+	if len(p.RetryableCodes) == 0 {
+		return code == server.CodeUnavailable
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 第attempt次重试（从0开始）前需要等待的时间
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 0; i < attempt && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// RetryBudget 是令牌桶形式的重试预算：每次重试消耗1个令牌，每次成功归还Ratio个令牌，
+// 令牌数不超过MaxTokens的一半时停止重试，避免服务整体故障时重试把流量放大好几倍
+type RetryBudget struct {
+	mu        sync.Mutex
+	maxTokens float64
+	ratio     float64
+	tokens    float64
+}
+
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return &RetryBudget{
+		maxTokens: maxTokens,
+		ratio:     ratio,
+		tokens:    maxTokens,
+	}
+}
+
+func (b *RetryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// 为一次重试消耗1个令牌，预算不足时返回false且不消耗
+func (b *RetryBudget) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens-1 <= b.maxTokens/2 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 判断第attempt次调用（从1开始）失败后是否还要重试，需要重试时返回等待时间
+func (p *RetryPolicy) shouldRetry(ctx context.Context, serviceMethod string, attempt int, err error, sent bool) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	if sent && !p.IdempotentMethods[serviceMethod] {
+		return 0, false
+	}
+	if !p.retryable(server.CodeOf(err)) {
+		return 0, false
+	}
+	wait := p.backoff(attempt - 1)
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return 0, false
+	}
+	//确定要重试时才消耗预算
+	if p.Budget != nil && !p.Budget.spend() {
+		return 0, false
+	}
+	return wait, true
+}
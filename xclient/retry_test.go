@@ -0,0 +1,186 @@
+package xclient
+
+import (
+	server2 "GeekRPC/server"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Flaky struct {
+	fail  bool
+	calls int32
+}
+
+func (f *Flaky) Do(args Args, reply *int) error {
+	atomic.AddInt32(&f.calls, 1)
+	if f.fail {
+		return server2.Errorf(server2.CodeUnavailable, "flaky: unavailable")
+	}
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func startFlakyServer(t *testing.T, fail bool) (*Flaky, string) {
+	flaky := &Flaky{fail: fail}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := server2.NewServer()
+	_ = server.Register(flaky)
+	go server.Accept(l)
+	return flaky, "tcp@" + l.Addr().String()
+}
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond * 10,
+		Multiplier:        2,
+		IdempotentMethods: map[string]bool{"Flaky.Do": true},
+	}
+}
+
+func TestXClient_RetryDeadServer(t *testing.T) {
+	_, good := startFlakyServer(t, false)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	dead := "tcp@" + l.Addr().String()
+	_ = l.Close()
+
+	xc := NewXClient(NewMultiServerDiscovery([]string{dead, good}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	var reply int
+	failed := 0
+	for i := 0; i < 4; i++ {
+		if err := xc.Call(context.Background(), "Flaky.Do", &Args{Num1: i, Num2: 1}, &reply); err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Fatal("expect some calls to fail without retry policy")
+	}
+
+	p := testRetryPolicy()
+	p.IdempotentMethods = nil //连接失败时请求没有发出去，非幂等的方法也可以重试
+	xc.SetRetryPolicy(p)
+	for i := 0; i < 4; i++ {
+		if err := xc.Call(context.Background(), "Flaky.Do", &Args{Num1: i, Num2: 1}, &reply); err != nil || reply != i+1 {
+			t.Fatalf("expect %d, got %d, err %v", i+1, reply, err)
+		}
+	}
+}
+
+func TestXClient_RetryIdempotent(t *testing.T) {
+	bad, badAddr := startFlakyServer(t, true)
+	_, goodAddr := startFlakyServer(t, false)
+	d := NewMultiServerDiscovery([]string{badAddr, goodAddr})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetRetryPolicy(testRetryPolicy())
+
+	var reply int
+	for i := 0; i < 4; i++ {
+		if err := xc.Call(context.Background(), "Flaky.Do", &Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect 3, got %d, err %v", reply, err)
+		}
+	}
+
+	//非幂等的方法请求已经发出去了，不能重试
+	p := testRetryPolicy()
+	p.IdempotentMethods = nil
+	xc.SetRetryPolicy(p)
+	before := atomic.LoadInt32(&bad.calls)
+	failed := 0
+	for i := 0; i < 4; i++ {
+		err := xc.Call(context.Background(), "Flaky.Do", &Args{Num1: 1, Num2: 2}, &reply)
+		if err != nil {
+			failed++
+			if server2.CodeOf(err) != server2.CodeUnavailable {
+				t.Fatalf("expect Unavailable, got %v", err)
+			}
+		}
+	}
+	if got := int(atomic.LoadInt32(&bad.calls) - before); got != failed || failed == 0 {
+		t.Fatalf("expect bad server called %d times, got %d", failed, got)
+	}
+}
+
+func TestXClient_RetryBudget(t *testing.T) {
+	bad1, addr1 := startFlakyServer(t, true)
+	bad2, addr2 := startFlakyServer(t, true)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr1, addr2}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	p := testRetryPolicy()
+	p.Budget = NewRetryBudget(4, 0.1)
+	xc.SetRetryPolicy(p)
+
+	var reply int
+	for i := 0; i < 5; i++ {
+		if err := xc.Call(context.Background(), "Flaky.Do", &Args{}, &reply); err == nil {
+			t.Fatal("expect error")
+		}
+	}
+	//预算为4时只允许1次重试，之后每次调用都只尝试一次
+	if calls := atomic.LoadInt32(&bad1.calls) + atomic.LoadInt32(&bad2.calls); calls != 6 {
+		t.Fatalf("expect 6 calls in total, got %d", calls)
+	}
+}
+
+func TestRetryPolicy_BudgetOnlySpentOnRetry(t *testing.T) {
+	p := testRetryPolicy()
+	p.Budget = NewRetryBudget(4, 0.1)
+	ctx := context.Background()
+	unavailable := server2.Errorf(server2.CodeUnavailable, "unavailable")
+
+	//不可重试的错误、用完的次数和非幂等的方法都不消耗预算
+	if _, ok := p.shouldRetry(ctx, "Flaky.Do", 1, server2.Errorf(server2.CodeInvalidArgument, "bad"), true); ok {
+		t.Fatal("expect no retry for non-retryable code")
+	}
+	if _, ok := p.shouldRetry(ctx, "Flaky.Do", p.MaxAttempts, unavailable, true); ok {
+		t.Fatal("expect no retry after MaxAttempts")
+	}
+	if _, ok := p.shouldRetry(ctx, "Other.Do", 1, unavailable, true); ok {
+		t.Fatal("expect no retry for non-idempotent method")
+	}
+	if p.Budget.tokens != 4 {
+		t.Fatalf("expect budget untouched, got %v tokens", p.Budget.tokens)
+	}
+
+	if _, ok := p.shouldRetry(ctx, "Flaky.Do", 1, unavailable, true); !ok {
+		t.Fatal("expect retry")
+	}
+	if p.Budget.tokens != 3 {
+		t.Fatalf("expect 3 tokens after one retry, got %v", p.Budget.tokens)
+	}
+	if _, ok := p.shouldRetry(ctx, "Flaky.Do", 1, unavailable, true); ok {
+		t.Fatal("expect budget to stop retries")
+	}
+}
+
+func TestXClient_RetryDeadline(t *testing.T) {
+	bad, addr := startFlakyServer(t, true)
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	p := testRetryPolicy()
+	p.MaxAttempts = 10
+	p.InitialBackoff = time.Millisecond * 200
+	p.MaxBackoff = time.Millisecond * 200
+	xc.SetRetryPolicy(p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	var reply int
+	if err := xc.Call(ctx, "Flaky.Do", &Args{}, &reply); err == nil {
+		t.Fatal("expect error")
+	}
+	if calls := atomic.LoadInt32(&bad.calls); calls != 2 {
+		t.Fatalf("expect 2 calls within deadline, got %d", calls)
+	}
+}
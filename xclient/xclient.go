@@ -4,9 +4,13 @@ import (
 	"GeekRPC/client"
 	"GeekRPC/server"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand"
 	"reflect"
 	"sync"
+	"time"
 )
 
 type XClient struct {
@@ -14,68 +18,349 @@ type XClient struct {
 	mode SelectMode
 	opt *server.Option
 	mu sync.Mutex
-	clients map[string]*client.Client
+	clients map[string]*clientEntry
+	retry *RetryPolicy
+	hedge *HedgePolicy
+	latency *latencyTracker //记录各个方法的调用耗时，用于计算对冲等待时间
+	breakerPolicy *BreakerPolicy
+	breakers map[string]*circuitBreaker
+	loads map[string]*addrLoad //各个服务的EWMA延迟，供负载感知的选择模式使用
+	dialFailureTTL time.Duration
+	poolOpt *client.PoolOption
+	hashOpt *ConsistentHashOption
+	ring *hashRing
+	evictPolicy *EvictPolicy
+	evictReset chan struct{}
+	healthCheck *healthChecker
+	unhealthy map[string]bool //健康检查返回NOT_SERVING的服务
+	done chan struct{} //Close时关闭，通知后台的清理协程退出
 }
 
+// clientEntry 是缓存的连接池及其最近一次被使用的时间。
+// 同一个地址同时只有一个协程在拨号，其他协程等待ready关闭后共享拨号结果
+type clientEntry struct {
+	ready chan struct{} //拨号结束时关闭，之后pool、err、failedAt不再变化
+	pool *client.Pool
+	err error
+	failedAt time.Time
+	lastUsed time.Time
+}
+
+// 拨号成功的连接池，拨号中或拨号失败时返回nil，调用方需要持有xc.mu
+func (e *clientEntry) connPool() *client.Pool {
+	select {
+	case <-e.ready:
+		return e.pool
+	default:
+		return nil
+	}
+}
+
+// xdial 建立到rpcAddr的连接，测试时可以替换
+var xdial = client.XDial
+
+// 拨号失败的结果缓存多久，期间对该地址的调用直接返回同样的错误，避免反复拨号
+const defaultDialFailureTTL = time.Second
+
+var ErrAllBreakersOpen error = server.NewError(server.CodeUnavailable,"rpc xclient: all servers are unavailable (circuit breaker open or not serving)")
+
 var _ io.Closer = (*XClient)(nil)
+var _ client.Invoker = (*XClient)(nil)
 
 func NewXClient(d Discovery, mode SelectMode, opt *server.Option) *XClient {
-	return &XClient{
+	xc := &XClient{
 		d: d,
 		mode: mode,
 		opt: opt,
-		clients: make(map[string]*client.Client),
+		clients: make(map[string]*clientEntry),
+		latency: newLatencyTracker(),
+		loads: make(map[string]*addrLoad),
+		unhealthy: make(map[string]bool),
+		dialFailureTTL: defaultDialFailureTTL,
+		evictPolicy: DefaultEvictPolicy,
+		evictReset: make(chan struct{},1),
+		done: make(chan struct{}),
 	}
+	go xc.evictLoop()
+	return xc
 }
 
 func (xc *XClient) Close() error {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
 
-	for key,client := range xc.clients {
-		_ = client.Close()
+	select {
+	case <-xc.done:
+	default:
+		close(xc.done)
+	}
+	if xc.healthCheck != nil {
+		xc.healthCheck.cancel()
+		xc.healthCheck = nil
+	}
+	for key,entry := range xc.clients {
+		//还在拨号的连接由拨号的协程发现xc已关闭后自己关闭
+		if pool := entry.connPool(); pool != nil {
+			_ = pool.Close()
+		}
 		delete(xc.clients,key)
 	}
 	
 	return nil
 }
 
-func (xc *XClient) dial(rpcAddr string) (*client.Client, error) {
+// SetPoolOption 设置到每个服务的连接池大小，nil表示每个服务只建立一个连接。
+// 只对之后新建的连接池生效
+func (xc *XClient) SetPoolOption(opt *client.PoolOption) {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
-	
-	clt,ok := xc.clients[rpcAddr]
-	if ok && !clt.IsAvailable() {
-		_ = clt.Close()
+	xc.poolOpt = opt
+}
+
+// SetDialFailureTTL 设置拨号失败的结果缓存多久，0表示不缓存
+func (xc *XClient) SetDialFailureTTL(ttl time.Duration) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.dialFailureTTL = ttl
+}
+
+// dial 从rpcAddr的连接池中返回一个连接。拨号时不持有xc.mu，不同地址可以同时拨号，
+// 同一个地址的并发调用共享一次拨号
+func (xc *XClient) dial(ctx context.Context, rpcAddr string) (*client.Client, error) {
+	for {
+		xc.mu.Lock()
+		entry := xc.clients[rpcAddr]
+		if entry != nil {
+			select {
+			case <-entry.ready:
+			default:
+				//其他协程正在拨号，等待它的结果
+				xc.mu.Unlock()
+				select {
+				case <-entry.ready:
+				case <-ctx.Done():
+					return nil,fmt.Errorf("rpc xclient: dial %s: %w",rpcAddr,ctx.Err())
+				}
+				continue
+			}
+
+			switch {
+			case entry.err != nil && time.Since(entry.failedAt) < xc.dialFailureTTL:
+				xc.mu.Unlock()
+				return nil,entry.err
+			case entry.err == nil && entry.pool.IsAvailable():
+				entry.lastUsed = time.Now()
+				xc.mu.Unlock()
+				return entry.pool.Get()
+			}
+			if entry.pool != nil {
+				_ = entry.pool.Close()
+			}
+			delete(xc.clients,rpcAddr)
+		}
+
+		entry = &clientEntry{ready: make(chan struct{})}
+		xc.clients[rpcAddr] = entry
+		poolOpt := client.PoolOption{MinSize: 1,MaxSize: 1}
+		if xc.poolOpt != nil {
+			poolOpt = *xc.poolOpt
+		}
+		xc.mu.Unlock()
+
+		if poolOpt.Dialer == nil {
+			dial := xdial
+			poolOpt.Dialer = func(rpcAddr string, opts ...*server.Option) (*client.Client, error) {
+				return dial(rpcAddr,opts...)
+			}
+		}
+		//拨号本身不能被取消，放到后台进行，调用方只等到ctx结束为止，拨号的结果仍然留给之后的调用
+		go xc.newPool(rpcAddr,entry,&poolOpt)
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return nil,fmt.Errorf("rpc xclient: dial %s: %w",rpcAddr,ctx.Err())
+		}
+		if entry.err != nil {
+			return nil,entry.err
+		}
+		return entry.pool.Get()
+	}
+}
+
+// 为entry建立连接池，结束时关闭entry.ready；xc已经关闭时丢弃新建的连接池
+func (xc *XClient) newPool(rpcAddr string, entry *clientEntry, poolOpt *client.PoolOption) {
+	pool,err := client.NewPool(rpcAddr,poolOpt,xc.opt)
+
+	xc.mu.Lock()
+	closed := false
+	select {
+	case <-xc.done:
+		closed = true
 		delete(xc.clients,rpcAddr)
-		clt = nil
+	default:
+	}
+	if closed && err == nil {
+		err = client.ErrShutdown
+	}
+	if err == nil {
+		entry.pool = pool
 	}
-	if clt == nil {
-		var err error
-		clt,err = client.XDial(rpcAddr,xc.opt)
+	entry.err = err
+	entry.lastUsed = time.Now()
+	if err != nil {
+		entry.failedAt = time.Now()
+	}
+	close(entry.ready)
+	xc.mu.Unlock()
+
+	if closed && pool != nil {
+		_ = pool.Close()
+	}
+}
+
+// SetRetryPolicy 设置Call失败后的重试策略，nil表示不重试
+func (xc *XClient) SetRetryPolicy(p *RetryPolicy) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.retry = p
+}
+
+// 按照mode选择一个服务，跳过熔断中的服务，并尽量避开exclude中已经调用失败过的服务；
+// 所有服务都失败过时仍然返回其中一个
+func (xc *XClient) pick(ctx context.Context, args interface{}, exclude map[string]bool) (string,error) {
+	if xc.mode.loadAware() || xc.mode == ConsistentHashSelect {
+		servers,err := xc.d.GetAll()
 		if err != nil {
-			return nil,err
+			return "",err
+		}
+		if len(servers) == 0 {
+			return "",errors.New("rpc discovery: no available servers")
 		}
-		xc.clients[rpcAddr] = clt
+		if xc.mode == ConsistentHashSelect {
+			return xc.pickByHash(ctx,args,servers,exclude)
+		}
+		return xc.pickFromAll(servers,exclude)
 	}
-	
-	return clt,nil
-}
 
-func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
 	rpcAddr,err := xc.d.Get(xc.mode)
 	if err != nil {
-		return err
+		return "",err
+	}
+	if !exclude[rpcAddr] && xc.allow(rpcAddr) {
+		return rpcAddr,nil
+	}
+
+	servers,err := xc.d.GetAll()
+	if err != nil {
+		return "",err
+	}
+	var candidates,excluded []string
+	for _,s := range servers {
+		if s == rpcAddr {
+			continue
+		}
+		if exclude[s] {
+			excluded = append(excluded,s)
+		} else {
+			candidates = append(candidates,s)
+		}
+	}
+	rand.Shuffle(len(candidates),func(i, j int) {
+		candidates[i],candidates[j] = candidates[j],candidates[i]
+	})
+	if exclude[rpcAddr] {
+		excluded = append(excluded,rpcAddr)
+	}
+	for _,s := range append(candidates,excluded...) {
+		if xc.allow(s) {
+			return s,nil
+		}
+	}
+	return "",ErrAllBreakersOpen
+}
+
+// 由XClient根据负载在servers中选择服务，优先选择不在exclude中的服务
+func (xc *XClient) pickFromAll(servers []string, exclude map[string]bool) (string,error) {
+	var candidates,excluded []string
+	for _,s := range servers {
+		if exclude[s] {
+			excluded = append(excluded,s)
+		} else {
+			candidates = append(candidates,s)
+		}
+	}
+	if s,ok := xc.pickByLoad(candidates); ok {
+		return s,nil
+	}
+	if s,ok := xc.pickByLoad(excluded); ok {
+		return s,nil
+	}
+	return "",ErrAllBreakersOpen
+}
+
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	xc.mu.Lock()
+	p,h := xc.retry,xc.hedge
+	xc.mu.Unlock()
+	if h != nil && !h.Methods[serviceMethod] {
+		h = nil
+	}
+
+	tried := make(map[string]bool)
+	for attempt := 1; ; attempt++ {
+		rpcAddr,err := xc.pick(ctx,args,tried)
+		if err != nil {
+			return err
+		}
+		tried[rpcAddr] = true
+
+		var sent bool
+		if h != nil {
+			sent,err = xc.hedgedCall(h,rpcAddr,ctx,serviceMethod,args,reply)
+		} else {
+			sent,err = xc.tryCall(rpcAddr,ctx,serviceMethod,args,reply)
+		}
+		if err == nil || p == nil {
+			if err == nil && p != nil && p.Budget != nil {
+				p.Budget.onSuccess()
+			}
+			return err
+		}
+
+		wait,ok := p.shouldRetry(ctx,serviceMethod,attempt,err,sent)
+		if !ok {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
 	}
-	return xc.call(rpcAddr,ctx,serviceMethod,args,reply)
 }
 
 func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	client ,err := xc.dial(rpcAddr)
+	_,err := xc.tryCall(rpcAddr,ctx,serviceMethod,args,reply)
+	return err
+}
+
+// 调用rpcAddr上的服务，sent表示请求是否可能已经发给了服务端
+func (xc *XClient) tryCall(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) (sent bool,err error) {
+	clt ,err := xc.dial(ctx,rpcAddr)
 	if err != nil {
-		return err
+		xc.recordResult(rpcAddr,err)
+		xc.observeResult(rpcAddr,failurePenalty,err)
+		return false,err
+	}
+	start := time.Now()
+	err = clt.Call(ctx,serviceMethod,args,reply)
+	rtt := time.Since(start)
+	xc.recordResult(rpcAddr,err)
+	xc.observeResult(rpcAddr,rtt,err)
+	if err == nil {
+		xc.latency.add(serviceMethod,rtt)
 	}
-	return client.Call(ctx,serviceMethod,args,reply)
+	return err != client.ErrShutdown,err
 }
 
 func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
@@ -90,6 +375,7 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 
 	replyDone := reply==nil
 	ctx,cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	for _,rpcAddr := range servers {
 		wg.Add(1)
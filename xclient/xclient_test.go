@@ -92,11 +92,12 @@ func broadcast(addr1,addr2 string)  {
 				Num1: i,
 				Num2: i * i,
 			})
-			ctx,_ := context.WithTimeout(context.Background(),time.Second*2)
+			ctx,cancel := context.WithTimeout(context.Background(),time.Second*2)
 			foo(xc,ctx,"broadcast","Foo.Sleep",&Args{
 				Num1: i,
 				Num2: i * i,
 			})
+			cancel()
 		}(i)
 	}
 	wg.Wait()